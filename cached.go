@@ -0,0 +1,167 @@
+package alfred
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Loader fetches a value for Cached
+type Loader func() (interface{}, error)
+
+// CacheInfo describes a value returned by Cached
+type CacheInfo struct {
+	// Updated is when the value was fetched
+	Updated time.Time
+	// Age is how old the value is
+	Age time.Duration
+	// Stale indicates that the value is older than the requested max age
+	Stale bool
+	// Refreshing indicates that a new value is being fetched
+	Refreshing bool
+	// Err is the error from the last failed fetch, if it failed after the
+	// value was fetched
+	Err error
+	// ErrTime is when the last failed fetch happened
+	ErrTime time.Time
+}
+
+// Cached reads a cached value into v. Values are kept in CacheDir().
+//
+// If there's no cached value, loader is called to fetch one, and its error (if
+// any) is returned. If the cached value is older than maxAge, it's returned
+// immediately and the value is refreshed by a background job (see
+// RunInBackground) that runs the workflow again with the same arguments, so
+// the command calling Cached must call it again with the same key and loader.
+// Alfred is asked to rerun the Script Filter so that the new value can be
+// shown once it's available.
+//
+// Fetch errors are recorded, so a Filter can show stale data along with the
+// reason it couldn't be refreshed. A failed refresh isn't retried for
+// refreshRetryInterval.
+//
+// Outside of Run, a stale value is refreshed before Cached returns.
+func (w *Workflow) Cached(key string, maxAge time.Duration, loader Loader, v interface{}) (info CacheInfo, err error) {
+	store := w.cacheStore().Namespace("cached")
+
+	var record cacheRecord
+	if err = store.Get(key, &record); err != nil && err != ErrNotFound {
+		return
+	}
+
+	if record.Value == nil {
+		dlog.Printf("Loading '%s'", key)
+		if err = w.refresh(store, key, loader); err != nil {
+			return
+		}
+		if err = store.Get(key, &record); err != nil {
+			return
+		}
+	}
+
+	if err = json.Unmarshal(record.Value, v); err != nil {
+		return
+	}
+
+	info = record.info()
+	if info.Age <= maxAge {
+		return
+	}
+
+	info.Stale = true
+	job := refreshJob(key)
+
+	if w.state == nil || w.env["alfred_job"] == job {
+		// Not running, so there's no run to repeat in the background, or this
+		// is the background refresh
+		if err := w.refresh(store, key, loader); err != nil {
+			dlog.Printf("Error refreshing '%s': %v", key, err)
+		}
+		if err := store.Get(key, &record); err == nil {
+			if err := json.Unmarshal(record.Value, v); err == nil {
+				info = record.info()
+				info.Stale = info.Age > maxAge
+			}
+		}
+		return info, nil
+	}
+
+	if info.Err != nil && time.Since(info.ErrTime) < refreshRetryInterval {
+		return
+	}
+
+	dlog.Printf("Refreshing '%s' in the background", key)
+
+	if err := w.RunInBackground(job, w.state.args...); err != nil {
+		dlog.Printf("Error starting refresh of '%s': %v", key, err)
+		return info, nil
+	}
+
+	info.Refreshing = true
+	w.Rerun(MinRerun)
+	return
+}
+
+// support -------------------------------------------------------------------
+
+// refreshRetryInterval is how long Cached waits to refresh a value again
+// after a refresh failed
+const refreshRetryInterval = time.Minute
+
+// refreshJob returns the name of the background job that refreshes a key
+func refreshJob(key string) string {
+	return "alfred.refresh." + key
+}
+
+// cacheRecord is a cached value and its status
+type cacheRecord struct {
+	Value     json.RawMessage `json:"value,omitempty"`
+	Updated   time.Time       `json:"updated"`
+	Error     string          `json:"error,omitempty"`
+	ErrorTime time.Time       `json:"errorTime"`
+}
+
+// info describes a cached value
+func (r *cacheRecord) info() (info CacheInfo) {
+	info.Updated = r.Updated
+	info.Age = time.Since(r.Updated)
+
+	if r.Error != "" && r.ErrorTime.After(r.Updated) {
+		info.Err = errors.New(r.Error)
+		info.ErrTime = r.ErrorTime
+	}
+
+	return
+}
+
+// refresh calls a loader and stores its result or error
+func (w *Workflow) refresh(store *Store, key string, loader Loader) error {
+	value, loadErr := loader()
+
+	var data []byte
+	if loadErr == nil {
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			loadErr = err
+		}
+	}
+
+	var record cacheRecord
+	err := store.Update(key, &record, func() error {
+		if loadErr != nil {
+			record.Error = loadErr.Error()
+			record.ErrorTime = time.Now()
+		} else {
+			record.Value = data
+			record.Updated = time.Now()
+			record.Error = ""
+			record.ErrorTime = time.Time{}
+		}
+		return nil
+	})
+
+	if loadErr != nil {
+		return loadErr
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package alfred
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_workflow_cache": t.TempDir()}, false)
+
+	calls := 0
+	loader := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	var v int
+	info, err := w.Cached("n", time.Hour, loader, &v)
+	if err != nil || v != 1 || info.Stale {
+		t.Fatalf("first call: got (%d, %+v, %v)", v, info, err)
+	}
+
+	info, err = w.Cached("n", time.Hour, loader, &v)
+	if err != nil || v != 1 || calls != 1 {
+		t.Fatalf("fresh call: got (%d, %+v, %v) with %d calls", v, info, err, calls)
+	}
+
+	// Outside of Run, a stale value is refreshed immediately
+	info, err = w.Cached("n", 0, loader, &v)
+	if err != nil || v != 2 {
+		t.Fatalf("stale call: got (%d, %+v, %v)", v, info, err)
+	}
+
+	// Errors are recorded
+	failed := errors.New("offline")
+	info, _ = w.Cached("n", 0, func() (interface{}, error) { return nil, failed }, &v)
+	if v != 2 || info.Err == nil || info.Err.Error() != "offline" {
+		t.Errorf("failed refresh: got (%d, %+v)", v, info)
+	}
+
+	if _, err = w.Cached("missing", 0, func() (interface{}, error) { return nil, failed }, &v); err != failed {
+		t.Errorf("failed load: got %v, want %v", err, failed)
+	}
+}
+
+// TestMain runs the background refreshes started by TestCachedInRun, which
+// re-execute the test binary with the workflow's arguments
+func TestMain(m *testing.M) {
+	if strings.HasPrefix(os.Getenv("alfred_job"), refreshJob("")) {
+		env := Env{}
+		for _, v := range os.Environ() {
+			if parts := strings.SplitN(v, "=", 2); strings.HasPrefix(parts[0], "alfred_") {
+				env[parts[0]] = parts[1]
+			}
+		}
+
+		w, _ := OpenWorkflowWithEnv(".", env, false)
+		w.RunWithOptions([]Command{cachedFilter(&w, func() (interface{}, error) {
+			time.Sleep(refreshDelay)
+			return "new", nil
+		})}, RunOptions{Args: os.Args[1:], Stdout: io.Discard})
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// refreshDelay is how long the background refresh in TestCachedInRun takes
+const refreshDelay = 500 * time.Millisecond
+
+// cachedFilter returns a filter that lists a cached value
+func cachedFilter(w *Workflow, loader Loader) Filter {
+	return filterFunc(func(arg, data string) ([]Item, error) {
+		var v string
+		info, err := w.Cached("v", time.Minute, loader, &v)
+		if err != nil {
+			return nil, err
+		}
+		return []Item{{Title: v, Subtitle: fmt.Sprintf("refreshing=%v", info.Refreshing)}}, nil
+	})
+}
+
+func TestCachedInRun(t *testing.T) {
+	env := Env{"alfred_version": "5.0", "alfred_workflow_cache": t.TempDir()}
+	w, _ := OpenWorkflowWithEnv(".", env, false)
+
+	calls := 0
+	filter := cachedFilter(&w, func() (interface{}, error) {
+		calls++
+		return "old", nil
+	})
+
+	run := func() string {
+		var out bytes.Buffer
+		w.RunWithOptions([]Command{filter}, RunOptions{
+			Args:   []string{`{"keyword":"func"}`},
+			Stdout: &out,
+		})
+		return out.String()
+	}
+
+	run()
+
+	// Make the cached value stale
+	store := w.cacheStore().Namespace("cached")
+	var record cacheRecord
+	store.Update("v", &record, func() error {
+		record.Updated = time.Now().Add(-time.Hour)
+		return nil
+	})
+
+	// The stale value is returned before the refresh finishes, and Alfred is
+	// asked to rerun
+	start := time.Now()
+	out := run()
+	if elapsed := time.Since(start); elapsed >= refreshDelay {
+		t.Errorf("Run took %v, so it waited for the refresh", elapsed)
+	}
+	if !strings.Contains(out, `"rerun":0.1`) || !strings.Contains(out, `"title":"old"`) ||
+		!strings.Contains(out, "refreshing=true") {
+		t.Errorf("got %q", out)
+	}
+	if calls != 1 {
+		t.Errorf("loader was called %d times in the workflow process, want 1", calls)
+	}
+
+	// The value is refreshed by a background job
+	waitForJob(t, &w, refreshJob("v"))
+	if out := run(); !strings.Contains(out, `"title":"new"`) || strings.Contains(out, `"rerun"`) {
+		t.Errorf("got %q", out)
+	}
+}
@@ -0,0 +1,111 @@
+package alfred
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// panicError is a recovered panic along with the stack of the goroutine that
+// panicked
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.value)
+}
+
+// capturePanic converts a recovered value into a panicError. If the value is
+// already a panicError (i.e., a panic that was forwarded from another
+// goroutine), it's returned as-is so its original stack is preserved.
+func capturePanic(value interface{}) *panicError {
+	if p, ok := value.(*panicError); ok {
+		return p
+	}
+	return &panicError{value: value, stack: debug.Stack()}
+}
+
+// handlePanic reports a panic that occurred during Run. A crash report is
+// written to the workflow's cache directory. In tell mode an error item is
+// sent to Alfred; its mods open the crash report or copy the stack trace.
+func (w *Workflow) handlePanic(p *panicError, mode ModeType) {
+	dlog.Printf("Recovered from %s\n%s", p, p.stack)
+
+	logFile, err := w.writeCrashReport(p)
+	if err != nil {
+		dlog.Printf("Error writing crash report: %v", err)
+	}
+
+	if mode == ModeDo {
+		fmt.Fprintf(w.output(), "Error: %s\n", p)
+		return
+	}
+
+	item := Item{
+		Title:     fmt.Sprintf("Error: %s", p),
+		Subtitle:  "The workflow crashed",
+		Copy:      string(p.stack),
+		LargeType: p.Error(),
+	}
+
+	if logFile != "" {
+		item.AddMod(ModCmd, ItemMod{
+			Subtitle: "Open the crash log",
+			Arg: &ItemArg{
+				Keyword: "alfred.open",
+				Mode:    ModeDo,
+				Data:    logFile,
+			},
+		})
+	}
+
+	item.AddMod(ModAlt, ItemMod{
+		Subtitle: "Copy the stack trace",
+		Arg: &ItemArg{
+			Keyword: "alfred.copy",
+			Mode:    ModeDo,
+			Data:    string(p.stack),
+		},
+	})
+
+	w.disableCache()
+	w.SendToAlfred(Items{item}, workflowData{})
+}
+
+// writeCrashReport writes a timestamped crash report to the cache directory,
+// returning the report's path
+func (w *Workflow) writeCrashReport(p *panicError) (filename string, err error) {
+	if w.cacheDir == "" {
+		return "", fmt.Errorf("no cache directory")
+	}
+
+	if err = os.MkdirAll(w.cacheDir, 0755); err != nil {
+		return
+	}
+
+	now := time.Now()
+	filename = path.Join(w.cacheDir, "crash-"+now.Format("20060102-150405")+".log")
+
+	var args []string
+	if w.state != nil {
+		args = w.state.args
+	}
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "Time: %s\n", now.Format(time.RFC3339))
+	fmt.Fprintf(&report, "Workflow: %s (%s)\n", w.name, w.bundleID)
+	fmt.Fprintf(&report, "Alfred: %s\n", w.env["alfred_version"])
+	fmt.Fprintf(&report, "Args: %q\n\n", args)
+	fmt.Fprintf(&report, "%s\n\n%s", p, p.stack)
+
+	if err = os.WriteFile(filename, []byte(report.String()), 0600); err != nil {
+		return "", err
+	}
+
+	return
+}
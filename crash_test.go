@@ -0,0 +1,40 @@
+package alfred
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCrashReport(t *testing.T) {
+	dir := t.TempDir()
+	w := testWorkflow()
+
+	filter := filterFunc(func(arg, data string) ([]Item, error) {
+		panic("boom")
+	})
+
+	var out bytes.Buffer
+	w.RunWithOptions([]Command{filter}, RunOptions{
+		Args:   []string{"query", `{"keyword":"func"}`},
+		Env:    Env{"alfred_version": "5.0", "alfred_workflow_cache": dir},
+		Stdout: &out,
+	})
+
+	if !strings.Contains(out.String(), "boom") {
+		t.Errorf("output doesn't describe the panic: %q", out.String())
+	}
+
+	logs, _ := filepath.Glob(filepath.Join(dir, "crash-*.log"))
+	if len(logs) != 1 {
+		t.Fatalf("got %d crash reports, want 1", len(logs))
+	}
+
+	report, _ := os.ReadFile(logs[0])
+	want := `Args: ["query" "{\"keyword\":\"func\"}"]`
+	if !strings.Contains(string(report), want) {
+		t.Errorf("report doesn't contain %s:\n%s", want, report)
+	}
+}
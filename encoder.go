@@ -0,0 +1,239 @@
+package alfred
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Encoder writes Script Filter responses in a format Alfred understands
+type Encoder interface {
+	Encode(w io.Writer, r *Response) error
+}
+
+// JSONEncoder writes responses in the Script Filter JSON format used by
+// Alfred 3 and later. Items are encoded and written one at a time.
+type JSONEncoder struct {
+	// Indent, if not empty, is used to pretty-print the output
+	Indent string
+}
+
+// Encode writes a response as JSON
+func (e JSONEncoder) Encode(w io.Writer, r *Response) error {
+	bw := bufio.NewWriter(w)
+
+	newline, indent, sep := "", "", ":"
+	if e.Indent != "" {
+		newline, indent, sep = "\n", e.Indent, ": "
+	}
+
+	marshal := func(v interface{}, prefix string) ([]byte, error) {
+		if e.Indent == "" {
+			return json.Marshal(v)
+		}
+		return json.MarshalIndent(v, prefix, e.Indent)
+	}
+
+	field := func(name string, v interface{}) error {
+		data, err := marshal(v, indent)
+		if err != nil {
+			return err
+		}
+		bw.WriteString(indent + `"` + name + `"` + sep)
+		bw.Write(data)
+		bw.WriteString("," + newline)
+		return nil
+	}
+
+	bw.WriteString("{" + newline)
+
+	if r.Rerun > 0 {
+		if err := field("rerun", r.Rerun.Seconds()); err != nil {
+			return err
+		}
+	}
+
+	if r.Cache != nil {
+		cache := jsonCache{
+			Seconds:     int(r.Cache.MaxAge / time.Second),
+			LooseReload: r.Cache.LooseReload,
+		}
+		if err := field("cache", &cache); err != nil {
+			return err
+		}
+	}
+
+	if len(r.Variables) > 0 {
+		if err := field("variables", r.Variables); err != nil {
+			return err
+		}
+	}
+
+	bw.WriteString(indent + `"items"` + sep + "[")
+
+	for i := range r.Items {
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString(newline + indent + indent)
+
+		data, err := marshal(&r.Items[i], indent+indent)
+		if err != nil {
+			return err
+		}
+		bw.Write(data)
+	}
+
+	if len(r.Items) > 0 {
+		bw.WriteString(newline + indent)
+	}
+	bw.WriteString("]" + newline + "}\n")
+
+	return bw.Flush()
+}
+
+// XMLEncoder writes responses in the legacy XML feedback format used by
+// Alfred 2. Only the item properties supported by Alfred 2 are included.
+// Items are encoded and written one at a time.
+type XMLEncoder struct{}
+
+// Encode writes a response as XML
+func (e XMLEncoder) Encode(w io.Writer, r *Response) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<?xml version="1.0"?>`)
+
+	enc := xml.NewEncoder(bw)
+	items := xml.StartElement{Name: xml.Name{Local: "items"}}
+
+	if err := enc.EncodeToken(items); err != nil {
+		return err
+	}
+
+	for i := range r.Items {
+		if err := enc.Encode(r.Items[i].toXML()); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.EncodeToken(items.End()); err != nil {
+		return err
+	}
+
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+
+	bw.WriteString("\n")
+	return bw.Flush()
+}
+
+// support -------------------------------------------------------------------
+
+// encoder returns the Encoder for a workflow's responses
+func (w *Workflow) encoder() Encoder {
+	if w.Encoder != nil {
+		return w.Encoder
+	}
+
+	if strings.HasPrefix(w.env["alfred_version"], "2") {
+		return XMLEncoder{}
+	}
+
+	return JSONEncoder{}
+}
+
+// jsonCache is the JSON representation of a Script Filter cache directive
+type jsonCache struct {
+	Seconds     int  `json:"seconds"`
+	LooseReload bool `json:"loosereload,omitempty"`
+}
+
+// xmlItem is the XML representation of an Alfred 2 item
+type xmlItem struct {
+	XMLName      xml.Name      `xml:"item"`
+	UID          string        `xml:"uid,attr,omitempty"`
+	Arg          string        `xml:"arg,attr,omitempty"`
+	Valid        string        `xml:"valid,attr"`
+	Autocomplete string        `xml:"autocomplete,attr,omitempty"`
+	Type         ItemType      `xml:"type,attr,omitempty"`
+	Title        string        `xml:"title"`
+	Subtitles    []xmlSubtitle `xml:"subtitle"`
+	Icon         *xmlIcon      `xml:"icon"`
+	Texts        []xmlText     `xml:"text"`
+	QuickLookURL string        `xml:"quicklookurl,omitempty"`
+}
+
+// xmlSubtitle is an item subtitle, optionally for a modifier key
+type xmlSubtitle struct {
+	Mod   ModKey `xml:"mod,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// xmlIcon is an item icon
+type xmlIcon struct {
+	Type IconType `xml:"type,attr,omitempty"`
+	Path string   `xml:",chardata"`
+}
+
+// xmlText is an item's copy or large type text
+type xmlText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// toXML converts an Item into its XML representation
+func (i *Item) toXML() (xi xmlItem) {
+	ji := i.toJSON()
+
+	xi = xmlItem{
+		UID:          ji.UID,
+		Arg:          ji.Arg,
+		Valid:        "no",
+		Autocomplete: ji.Autocomplete,
+		Type:         ji.Type,
+		Title:        ji.Title,
+		QuickLookURL: ji.QuickLookURL,
+	}
+
+	if ji.Valid {
+		xi.Valid = "yes"
+	}
+
+	if ji.Subtitle != "" {
+		xi.Subtitles = append(xi.Subtitles, xmlSubtitle{Value: ji.Subtitle})
+	}
+
+	var mods []string
+	for key := range ji.Mods {
+		mods = append(mods, string(key))
+	}
+	sort.Strings(mods)
+
+	for _, key := range mods {
+		if mod := ji.Mods[ModKey(key)]; mod.Subtitle != "" {
+			xi.Subtitles = append(xi.Subtitles, xmlSubtitle{
+				Mod:   ModKey(key),
+				Value: mod.Subtitle,
+			})
+		}
+	}
+
+	if ji.Icon != nil {
+		xi.Icon = &xmlIcon{Type: ji.Icon.Type, Path: ji.Icon.Path}
+	}
+
+	if ji.Text != nil {
+		if ji.Text.Copy != "" {
+			xi.Texts = append(xi.Texts, xmlText{"copy", ji.Text.Copy})
+		}
+		if ji.Text.LargeType != "" {
+			xi.Texts = append(xi.Texts, xmlText{"largetype", ji.Text.LargeType})
+		}
+	}
+
+	return
+}
@@ -0,0 +1,119 @@
+package alfred
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testResponses = map[string]*Response{
+	"empty": {},
+	"items": {Items: Items{
+		{Title: "one", Subtitle: "first"},
+		{Title: "two", Arg: &ItemArg{Keyword: "k", Data: `"quoted" <data>`}},
+	}},
+	"everything": {
+		Items:     Items{{Title: "one"}},
+		Rerun:     time.Second,
+		Cache:     &ResultCache{MaxAge: time.Minute, LooseReload: true},
+		Variables: map[string]string{"a": "b"},
+	},
+}
+
+func TestJSONEncoder(t *testing.T) {
+	for name, r := range testResponses {
+		t.Run(name, func(t *testing.T) {
+			var compact interface{}
+
+			for _, indent := range []string{"", "  ", "\t"} {
+				var buf bytes.Buffer
+				if err := (JSONEncoder{Indent: indent}).Encode(&buf, r); err != nil {
+					t.Fatalf("indent %q: %v", indent, err)
+				}
+
+				var decoded interface{}
+				if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+					t.Fatalf("indent %q: invalid JSON %q: %v", indent, buf.String(), err)
+				}
+
+				if indent == "" {
+					compact = decoded
+				} else if !reflect.DeepEqual(decoded, compact) {
+					t.Errorf("indent %q: got %v, want %v", indent, decoded, compact)
+				}
+			}
+
+			m := compact.(map[string]interface{})
+			if items := m["items"].([]interface{}); len(items) != len(r.Items) {
+				t.Errorf("got %d items, want %d", len(items), len(r.Items))
+			}
+			if _, ok := m["rerun"]; ok != (r.Rerun > 0) {
+				t.Errorf("rerun present: %v", ok)
+			}
+			if _, ok := m["cache"]; ok != (r.Cache != nil) {
+				t.Errorf("cache present: %v", ok)
+			}
+			if _, ok := m["variables"]; ok != (len(r.Variables) > 0) {
+				t.Errorf("variables present: %v", ok)
+			}
+		})
+	}
+}
+
+func TestXMLEncoder(t *testing.T) {
+	for name, r := range testResponses {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := (XMLEncoder{}).Encode(&buf, r); err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded struct {
+				Items []struct {
+					Title string `xml:"title"`
+				} `xml:"item"`
+			}
+			if err := xml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatalf("invalid XML %q: %v", buf.String(), err)
+			}
+			if len(decoded.Items) != len(r.Items) {
+				t.Errorf("got %d items, want %d", len(decoded.Items), len(r.Items))
+			}
+		})
+	}
+}
+
+func TestRunAlfred2(t *testing.T) {
+	filter := filterFunc(func(arg, data string) ([]Item, error) {
+		return []Item{{Title: "result"}}, nil
+	})
+
+	for version, wantXML := range map[string]bool{"2.8": true, "2.8.1": true, "5.0": false} {
+		w, _ := OpenWorkflowWithEnv(".", Env{"alfred_version": version}, false)
+		out := runTest(t, &w, []Command{filter}, `{"keyword":"func"}`)
+
+		var r struct {
+			Items []struct {
+				Title string `xml:"title"`
+			} `xml:"item"`
+		}
+		err := xml.Unmarshal([]byte(out), &r)
+		if isXML := err == nil; isXML != wantXML {
+			t.Errorf("%s: got %q, want XML=%v", version, out, wantXML)
+			continue
+		}
+		if wantXML && (len(r.Items) != 1 || r.Items[0].Title != "result") {
+			t.Errorf("%s: got items %+v, want the filter's result", version, r.Items)
+		}
+	}
+
+	// Older versions are still refused
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_version": "1.2"}, false)
+	if out := runTest(t, &w, []Command{filter}, `{"keyword":"func"}`); !strings.Contains(out, "requires Alfred 2.0+") {
+		t.Errorf("1.2: got %q", out)
+	}
+}
@@ -0,0 +1,119 @@
+package alfred
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Env is a set of Alfred workflow environment variables, such as
+// alfred_workflow_bundleid and alfred_workflow_cache.
+type Env map[string]string
+
+// LoadEnv loads the workflow environment for the workflow in dir.
+//
+// When a workflow is run by Alfred, the environment is read from the
+// alfred_* variables in the process environment. Otherwise (e.g., when a
+// workflow is run from a terminal), the environment is derived from the
+// info.plist in dir (or in dir/workflow) and the installed Alfred app.
+func LoadEnv(dir string) (env Env, err error) {
+	env = Env{}
+
+	for _, v := range os.Environ() {
+		if strings.HasPrefix(v, "alfred_") {
+			parts := strings.SplitN(v, "=", 2)
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	version := env["alfred_version"]
+	dlog.Printf("Alfred version: %s", version)
+
+	if version == "" {
+		// If alfred_version wasn't present in the environment, initialize it
+		// manually
+		err = env.loadLocal(dir)
+	} else {
+		env["alfred_short_version"] = strings.SplitN(version, ".", 2)[0]
+	}
+
+	return
+}
+
+// support -------------------------------------------------------------------
+
+// loadLocal fills in an environment using the workflow's info.plist and the
+// installed Alfred app
+func (e Env) loadLocal(dir string) (err error) {
+	plFile := path.Join(dir, "workflow", "info.plist")
+	if !fileExists(plFile) {
+		plFile = path.Join(dir, "info.plist")
+	}
+	if !fileExists(plFile) {
+		return fmt.Errorf("alfred must be run in a workflow directory")
+	}
+
+	var plData Plist
+	if plData, err = readPlist(plFile); err != nil {
+		return
+	}
+
+	bundleID, _ := plData["bundleid"].(string)
+	name, _ := plData["name"].(string)
+
+	e["alfred_workflow_bundleid"] = bundleID
+	e["alfred_workflow_name"] = name
+
+	dlog.Printf("Looking for app in /Applications")
+	var version string
+	files, _ := os.ReadDir("/Applications")
+	matcher := regexp.MustCompile(`Alfred( \d+)?.app`)
+	var appname string
+	for _, file := range files {
+		fname := file.Name()
+		if fname[0] < 'A' {
+			dlog.Printf("Ignoring %s", fname)
+			continue
+		}
+		if fname[0] > 'A' {
+			dlog.Printf("Ignoring %s", fname)
+			break
+		}
+		if matcher.MatchString(fname) && fname > appname {
+			dlog.Printf("Using %s", fname)
+			appname = fname
+		}
+	}
+
+	if appname == "" {
+		return fmt.Errorf("could not find Alfred app")
+	}
+
+	dlog.Printf("Found app at %s", appname)
+	appname = strings.TrimSuffix(appname, ".app")
+	parts := strings.Split(appname, " ")
+	if len(parts) == 2 {
+		version = parts[1]
+		dlog.Printf("Using app version %s", version)
+		e["alfred_short_version"] = version
+	}
+
+	if version == "" {
+		return fmt.Errorf("could not determine Alfred version")
+	}
+
+	var u *user.User
+	if u, err = user.Current(); err != nil {
+		return fmt.Errorf("error getting user: %v", err)
+	}
+
+	e["alfred_workflow_cache"] = path.Join(u.HomeDir, "Library", "Caches",
+		"com.runningwithcrayons.Alfred-"+version, "Workflow Data", bundleID)
+	e["alfred_workflow_data"] = path.Join(u.HomeDir, "Library",
+		"Application Support", "Alfred "+version, "Workflow Data", bundleID)
+
+	return
+}
@@ -0,0 +1,100 @@
+package alfred
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Severity describes how serious an Error is
+type Severity int
+
+// Severity constants
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+)
+
+// Icon returns the path of the system icon for a Severity
+func (s Severity) Icon() string {
+	const icons = "/System/Library/CoreServices/CoreTypes.bundle/Contents/Resources/"
+	switch s {
+	case SeverityWarning:
+		return icons + "AlertCautionIcon.icns"
+	case SeverityInfo:
+		return icons + "AlertNoteIcon.icns"
+	default:
+		return icons + "AlertStopIcon.icns"
+	}
+}
+
+// Error is an error with information for the user. When a Filter returns an
+// Error, Run renders it as an item with the Error's Title, Hint, and Severity
+// icon. If the Error has a Recovery arg, the item can be actioned to recover
+// from the error (e.g., by jumping to a command that re-enters an API token).
+// When an Action returns an Error, Run outputs a message suitable for a
+// notification.
+type Error struct {
+	// Title is a short description of the problem
+	Title string
+	// Hint tells the user what they can do about the problem
+	Hint string
+	// Severity determines the icon the error is displayed with
+	Severity Severity
+	// Recovery is an optional arg used when the error item is actioned
+	Recovery *ItemArg
+	// Err is the underlying error, if any
+	Err error
+}
+
+// Error returns a string describing an Error
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Title, e.Err)
+	}
+	return e.Title
+}
+
+// Unwrap returns the error underlying an Error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Item returns an Item representing an Error
+func (e *Error) Item() Item {
+	return Item{
+		Title:    e.Title,
+		Subtitle: e.Hint,
+		Icon:     e.Severity.Icon(),
+		Arg:      e.Recovery,
+	}
+}
+
+// Message returns a single-line description of an Error suitable for a
+// notification
+func (e *Error) Message() string {
+	if e.Hint != "" {
+		return fmt.Sprintf("%s: %s", e.Title, e.Hint)
+	}
+	return e.Title
+}
+
+// support -------------------------------------------------------------------
+
+// errorItem returns an Item representing an error
+func errorItem(err error) Item {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Item()
+	}
+	return Item{Title: fmt.Sprintf("Error: %s", err)}
+}
+
+// errorMessage returns a description of an error suitable for a notification
+func errorMessage(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Message()
+	}
+	return fmt.Sprintf("Error: %s", err)
+}
@@ -9,6 +9,23 @@ func FuzzyMatches(val string, test string) bool {
 	return fuzzyScore(val, test) >= 0
 }
 
+// FuzzyMatchesAny returns true if test fuzzy matches any of vals
+func FuzzyMatchesAny(vals []string, test string) bool {
+	return bestFuzzyScore(vals, test) >= 0
+}
+
+// bestFuzzyScore returns the best (lowest) score for how well test fuzzy
+// matches any of vals, or -1 if it matches none of them.
+func bestFuzzyScore(vals []string, test string) float64 {
+	best := -1.0
+	for _, val := range vals {
+		if score := fuzzyScore(val, test); score >= 0 && (best < 0 || score < best) {
+			best = score
+		}
+	}
+	return best
+}
+
 // fuzzyScore gives a score for how well the test script fuzzy matches a
 // given value. To match, the test string must be equal to, or its characters
 // must be an ordered subset of, the characters in the val string. A score of 0
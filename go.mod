@@ -1,9 +1,10 @@
 module github.com/jason0x43/go-alfred
 
-go 1.13
+go 1.18
 
 require (
 	github.com/Masterminds/semver v1.5.0
 	github.com/blang/semver v3.5.1+incompatible
+	golang.org/x/crypto v0.9.0
 	howett.net/plist v0.0.0-20181124034731-591f970eefbb
 )
@@ -13,12 +13,38 @@ type Item struct {
 	Autocomplete string
 	Arg          *ItemArg
 	Icon         string
+	// IconType determines how Icon is interpreted. By default, Icon is the
+	// path of an image file.
+	IconType IconType
+	// Type is the item's type. File items are treated as files by Alfred.
+	Type ItemType
+	// Copy is the text copied when the user presses cmd-C on the item
+	Copy string
+	// LargeType is the text shown when the user presses cmd-L on the item
+	LargeType string
+	// QuickLookURL is the URL or file path shown by Quick Look
+	QuickLookURL string
+	// Match is the text Alfred matches against when the Script Filter has
+	// "Alfred filters results" enabled. By default, Title is used.
+	Match string
+	// Action is the content passed to Universal Actions
+	Action *ItemAction
+	// Variables are workflow variables set when the item is actioned
+	Variables map[string]string
 
 	mods map[ModKey]ItemMod
+	// data is the view the item is shown in
 	data workflowData
+	// command is the keyword path of the command that generated the item,
+	// if it's not the view's command (e.g., for global search results)
+	command string
+	// spill stores oversized args
+	spill *spiller
 
 	// Used for sorting
 	fuzzyScore float64
+	// Additional strings matched against by FuzzySort, such as aliases
+	fuzzyKeys []string
 }
 
 // ItemArg is an item argument
@@ -29,12 +55,64 @@ type ItemArg struct {
 	Mode ModeType
 	// Data is the data string that will be passed to the target Command
 	Data string
+	// Push records the current view (keyword, query, and data) on the
+	// navigation stack before moving to the target Command, so that it can
+	// be returned to with ModeBack.
+	Push bool
+	// Title is the title of the view the arg leads to, used in breadcrumbs.
+	// If it's empty, the target keyword is used.
+	Title string
+}
+
+// ItemType is the type of an item
+type ItemType string
+
+// ItemType constants
+const (
+	ItemTypeDefault ItemType = "default"
+	// ItemTypeFile indicates that an item represents a file. Alfred checks
+	// that the file exists.
+	ItemTypeFile ItemType = "file"
+	// ItemTypeFileSkipCheck indicates that an item represents a file, but
+	// Alfred doesn't check that the file exists.
+	ItemTypeFileSkipCheck ItemType = "file:skipcheck"
+)
+
+// IconType describes how an item's Icon is interpreted
+type IconType string
+
+// IconType constants
+const (
+	// IconTypeFileIcon uses the icon of the file at the Icon path
+	IconTypeFileIcon IconType = "fileicon"
+	// IconTypeFileType uses the icon for a file type, such as
+	// "com.apple.folder"
+	IconTypeFileType IconType = "filetype"
+)
+
+// ItemAction is the content an item passes to Alfred's Universal Actions.
+// Each kind of content may have multiple values.
+type ItemAction struct {
+	Text []string
+	URL  []string
+	File []string
+	// Auto is content whose type Alfred determines automatically
+	Auto []string
 }
 
 // ItemMod is a modifier
 type ItemMod struct {
 	Arg      *ItemArg
 	Subtitle string
+	// Icon replaces the item's icon while the modifier is held
+	Icon     string
+	IconType IconType
+	// Valid makes the item actionable with the modifier even if the mod has
+	// no Arg. Mods with an Arg are always valid.
+	Valid bool
+	// Variables are workflow variables set when the item is actioned with
+	// the modifier
+	Variables map[string]string
 }
 
 // AddMod adds a an ItemMod to an Item's mod map, creating the map if necessary
@@ -68,14 +146,81 @@ func (i Items) MarshalJSON() ([]byte, error) {
 
 // MarshalJSON marshals an Item into JSON
 func (i *Item) MarshalJSON() ([]byte, error) {
-	ji := jsonItem{
+	return json.Marshal(i.toJSON())
+}
+
+// FuzzySort sorts an items list in-place based how well they match a given
+// test string. An item's score is the best score of its title and any
+// aliases.
+func FuzzySort(items []Item, test string) {
+	for idx := range items {
+		keys := append([]string{items[idx].Title}, items[idx].fuzzyKeys...)
+		items[idx].fuzzyScore = bestFuzzyScore(keys, test)
+	}
+	sort.Stable(byFuzzyScore(items))
+}
+
+// InsertItem inserts an item at a specific index in an array of Items.
+func InsertItem(items []Item, item Item, index int) Items {
+	items = append(items, item)
+	copy(items[index+1:], items[index:])
+	items[index] = item
+	return items
+}
+
+// ByTitle is an array of Items which will be sorted by title.
+type ByTitle Items
+
+// Len returns the length of a ByTitle array.
+func (b ByTitle) Len() int {
+	return len(b)
+}
+
+// Swap swaps two elements in a ByTitle array.
+func (b ByTitle) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+// Less indicates whether one ByTitle element should come before another.
+func (b ByTitle) Less(i, j int) bool {
+	return b[i].Title < b[j].Title
+}
+
+// support -------------------------------------------------------------------
+
+// toJSON converts an Item into its JSON representation
+func (i *Item) toJSON() (ji jsonItem) {
+	ji = jsonItem{
 		UID:          i.UID,
 		Title:        i.Title,
 		Valid:        i.Arg != nil,
 		Autocomplete: i.Autocomplete,
+		Type:         i.Type,
+		QuickLookURL: i.QuickLookURL,
+		Match:        i.Match,
+		Variables:    i.Variables,
+	}
+
+	if i.Copy != "" || i.LargeType != "" {
+		ji.Text = &jsonText{
+			Copy:      i.Copy,
+			LargeType: i.LargeType,
+		}
+	}
+
+	if i.Action != nil {
+		ji.Action = &jsonAction{
+			Text: i.Action.Text,
+			URL:  i.Action.URL,
+			File: i.Action.File,
+			Auto: i.Action.Auto,
+		}
 	}
 
 	data := i.data
+	if i.command != "" {
+		data.Keyword = i.command
+	}
 
 	if i.Arg != nil {
 		if i.Arg.Keyword != "" {
@@ -88,15 +233,21 @@ func (i *Item) MarshalJSON() ([]byte, error) {
 		}
 
 		data.Data = i.Arg.Data
+
+		if i.Arg.Push {
+			data.push(i.data)
+		}
+		data.Title = i.Arg.Title
 	}
 
 	// Clear the mod flag in case it was set when we got here
 	data.Mod = ""
 
-	ji.Arg = Stringify(data)
+	ji.Arg = i.spill.arg(data)
 
 	if i.Icon != "" {
 		ji.Icon = &jsonIcon{
+			Type: i.IconType,
 			Path: i.Icon,
 		}
 	}
@@ -109,68 +260,48 @@ func (i *Item) MarshalJSON() ([]byte, error) {
 		ji.Mods = map[ModKey]jsonMod{}
 
 		for key, mod := range i.mods {
+			// Each mod starts from the item's data so that mods without args
+			// don't pick up another mod's arg
+			modData := data
+
 			if mod.Arg != nil {
-				data.Keyword = mod.Arg.Keyword
-				data.Mode = mod.Arg.Mode
-				data.Data = mod.Arg.Data
+				modData.Keyword = mod.Arg.Keyword
+				modData.Mode = mod.Arg.Mode
+				modData.Data = mod.Arg.Data
+
+				if mod.Arg.Push {
+					modData.push(i.data)
+				}
+				modData.Title = mod.Arg.Title
 			}
 
-			if data.Mode == "" {
-				data.Mode = ModeTell
+			if modData.Mode == "" {
+				modData.Mode = ModeTell
 			}
 
-			data.Mod = key
+			modData.Mod = key
 
-			ji.Mods[key] = jsonMod{
-				Arg:      Stringify(data),
-				Valid:    mod.Arg != nil,
-				Subtitle: mod.Subtitle,
+			jm := jsonMod{
+				Arg:       i.spill.arg(modData),
+				Valid:     mod.Arg != nil || mod.Valid,
+				Subtitle:  mod.Subtitle,
+				Variables: mod.Variables,
 			}
-		}
-
-		data.Mod = ""
-	}
 
-	return json.Marshal(ji)
-}
+			if mod.Icon != "" {
+				jm.Icon = &jsonIcon{
+					Type: mod.IconType,
+					Path: mod.Icon,
+				}
+			}
 
-// FuzzySort sorts an items list in-place based how well they match a given
-// test string.
-func FuzzySort(items []Item, test string) {
-	for idx := range items {
-		items[idx].fuzzyScore = fuzzyScore(items[idx].Title, test)
+			ji.Mods[key] = jm
+		}
 	}
-	sort.Stable(byFuzzyScore(items))
-}
-
-// InsertItem inserts an item at a specific index in an array of Items.
-func InsertItem(items []Item, item Item, index int) Items {
-	items = append(items, item)
-	copy(items[index+1:], items[index:])
-	items[index] = item
-	return items
-}
-
-// ByTitle is an array of Items which will be sorted by title.
-type ByTitle Items
 
-// Len returns the length of a ByTitle array.
-func (b ByTitle) Len() int {
-	return len(b)
+	return
 }
 
-// Swap swaps two elements in a ByTitle array.
-func (b ByTitle) Swap(i, j int) {
-	b[i], b[j] = b[j], b[i]
-}
-
-// Less indicates whether one ByTitle element should come before another.
-func (b ByTitle) Less(i, j int) bool {
-	return b[i].Title < b[j].Title
-}
-
-// support -------------------------------------------------------------------
-
 // jsonItem is the JSON representation of an Alfred item
 type jsonItem struct {
 	UID          string             `json:"uid,omitempty"`
@@ -180,32 +311,36 @@ type jsonItem struct {
 	Icon         *jsonIcon          `json:"icon,omitempty"`
 	Valid        bool               `json:"valid"`
 	Autocomplete string             `json:"autocomplete,omitempty"`
-	Type         jsonType           `json:"type,omitempty"`
+	Type         ItemType           `json:"type,omitempty"`
 	Mods         map[ModKey]jsonMod `json:"mods,omitempty"`
 	Text         *jsonText          `json:"text,omitempty"`
 	QuickLookURL string             `json:"quicklookurl,omitempty"`
+	Match        string             `json:"match,omitempty"`
+	Action       *jsonAction        `json:"action,omitempty"`
+	Variables    map[string]string  `json:"variables,omitempty"`
 }
 
-// jsonType is the type of a JSON item
-type jsonType string
-
-const (
-	typeDefault       jsonType = "default"
-	typeFile          jsonType = "file"
-	typeFileSkipCheck jsonType = "file:skipcheck"
-)
-
 // jsonIcon represents an icon
 type jsonIcon struct {
-	Type string `json:"type,omitempty"`
-	Path string `json:"path"`
+	Type IconType `json:"type,omitempty"`
+	Path string   `json:"path"`
+}
+
+// jsonAction represents an item's Universal Action content
+type jsonAction struct {
+	Text []string `json:"text,omitempty"`
+	URL  []string `json:"url,omitempty"`
+	File []string `json:"file,omitempty"`
+	Auto []string `json:"auto,omitempty"`
 }
 
 // jsonMod represents an item subtitle
 type jsonMod struct {
-	Arg      string `json:"arg,omitempty"`
-	Valid    bool   `json:"valid"`
-	Subtitle string `json:"subtitle,omitempty"`
+	Arg       string            `json:"arg,omitempty"`
+	Valid     bool              `json:"valid"`
+	Subtitle  string            `json:"subtitle,omitempty"`
+	Icon      *jsonIcon         `json:"icon,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
 }
 
 // jsonText represents an item's optional texts
@@ -0,0 +1,119 @@
+package alfred
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMods(t *testing.T) {
+	tests := []struct {
+		keys []ModKey
+		want ModKey
+	}{
+		{nil, ""},
+		{[]ModKey{ModCmd}, "cmd"},
+		{[]ModKey{ModShift, ModCmd}, "cmd+shift"},
+		{[]ModKey{ModFn, ModShift, ModCtrl, ModAlt, ModCmd}, "cmd+alt+ctrl+shift+fn"},
+		{[]ModKey{ModCmd, ModCmd, ModShift}, "cmd+shift"},
+		{[]ModKey{"shift+cmd", ModCmd}, "cmd+shift"},
+		{[]ModKey{"ctrl+alt", "alt+fn"}, "alt+ctrl+fn"},
+		{[]ModKey{"meta"}, ""},
+	}
+
+	for _, test := range tests {
+		if got := Mods(test.keys...); got != test.want {
+			t.Errorf("Mods(%q): got %q, want %q", test.keys, got, test.want)
+		}
+	}
+}
+
+func TestModKeyHelpers(t *testing.T) {
+	if got := ModShift.With(ModCmd, ModShift); got != "cmd+shift" {
+		t.Errorf("With: got %q", got)
+	}
+
+	combo := Mods(ModCmd, ModAlt)
+	if got, want := combo.Keys(), []ModKey{ModCmd, ModAlt}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys: got %q, want %q", got, want)
+	}
+	if keys := ModKey("").Keys(); keys != nil {
+		t.Errorf("Keys of no mods: got %q", keys)
+	}
+
+	for key, want := range map[ModKey]bool{ModCmd: true, ModAlt: true, ModShift: false, "cmd+alt": false} {
+		if got := combo.Has(key); got != want {
+			t.Errorf("Has(%q): got %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestItemModsJSON(t *testing.T) {
+	item := Item{
+		Title: "item",
+		Arg:   &ItemArg{Keyword: "open", Data: "item data"},
+	}
+	item.AddMod(Mods(ModShift, ModCmd), ItemMod{
+		Arg:       &ItemArg{Keyword: "copy", Mode: ModeDo, Data: "combo data"},
+		Subtitle:  "Copy it",
+		Icon:      "copy.png",
+		IconType:  IconTypeFileIcon,
+		Variables: map[string]string{"via": "combo"},
+	})
+	item.AddMod(ModAlt, ItemMod{Subtitle: "Valid without an arg", Valid: true})
+	item.AddMod(ModFn, ItemMod{Subtitle: "Not actionable"})
+
+	data, err := json.Marshal(&item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ji struct {
+		Mods map[string]struct {
+			Arg       string            `json:"arg"`
+			Valid     bool              `json:"valid"`
+			Subtitle  string            `json:"subtitle"`
+			Icon      *jsonIcon         `json:"icon"`
+			Variables map[string]string `json:"variables"`
+		} `json:"mods"`
+	}
+	if err := json.Unmarshal(data, &ji); err != nil {
+		t.Fatal(err)
+	}
+
+	combo, ok := ji.Mods["cmd+shift"]
+	if !ok {
+		t.Fatalf("no cmd+shift mod in %s", data)
+	}
+	if !combo.Valid || combo.Subtitle != "Copy it" || combo.Variables["via"] != "combo" {
+		t.Errorf("combined mod: got %+v", combo)
+	}
+	if combo.Icon == nil || combo.Icon.Path != "copy.png" || combo.Icon.Type != IconTypeFileIcon {
+		t.Errorf("combined mod icon: got %+v", combo.Icon)
+	}
+
+	modData := func(key string) (d workflowData) {
+		if err := json.Unmarshal([]byte(ji.Mods[key].Arg), &d); err != nil {
+			t.Fatalf("%s: invalid arg %q", key, ji.Mods[key].Arg)
+		}
+		return
+	}
+
+	if d := modData("cmd+shift"); d.Keyword != "copy" || d.Mode != ModeDo || d.Data != "combo data" || d.Mod != "cmd+shift" {
+		t.Errorf("combined mod data: got %+v", d)
+	}
+
+	// Mods without args use the item's arg, not another mod's
+	for _, key := range []string{"alt", "fn"} {
+		if d := modData(key); d.Keyword != "open" || d.Mode != ModeTell || d.Data != "item data" || string(d.Mod) != key {
+			t.Errorf("%s mod data: got %+v", key, d)
+		}
+	}
+
+	if !ji.Mods["alt"].Valid {
+		t.Error("alt mod isn't valid")
+	}
+	if ji.Mods["fn"].Valid {
+		t.Error("fn mod is valid without an arg")
+	}
+}
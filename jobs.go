@@ -0,0 +1,172 @@
+package alfred
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RunInBackground runs the workflow's executable with the given arguments in
+// a detached process that keeps running after the workflow exits. The job is
+// tracked by name in CacheDir(): the job holds an advisory lock on a lock
+// file for as long as it runs, and a job won't be started if a job with the
+// same name holds its lock. A job's stderr (including debug logging) is
+// written to a log file next to its lock file.
+//
+// The job's environment is the workflow's environment (including any
+// environment given to OpenWorkflowWithEnv or RunWithOptions) layered over
+// the process environment, with the variable alfred_job set to the job's
+// name.
+func (w *Workflow) RunInBackground(name string, args ...string) (err error) {
+	var dir string
+	if dir, err = w.jobDir(); err != nil {
+		return
+	}
+
+	// Keep IsRunning from probing the job's lock while it's being taken
+	var unlock func()
+	if unlock, err = lockFile(path.Join(dir, ".lock"), true); err != nil {
+		return
+	}
+	defer unlock()
+
+	var lock *os.File
+	var ok bool
+	if lock, ok, err = tryLockFile(jobFile(dir, name, ".lock")); err != nil {
+		return
+	} else if !ok || (!lockingSupported && w.jobPID(dir, name) != 0) {
+		if lock != nil {
+			lock.Close()
+		}
+		dlog.Printf("Job '%s' is already running", name)
+		return
+	}
+	// The job inherits the lock, so closing this copy doesn't release it
+	defer lock.Close()
+
+	var executable string
+	if executable, err = os.Executable(); err != nil {
+		return
+	}
+
+	var log *os.File
+	if log, err = os.Create(jobFile(dir, name, ".log")); err != nil {
+		return
+	}
+	defer log.Close()
+
+	cmd := exec.Command(executable, args...)
+	cmd.Dir = w.workflowDir
+	cmd.Env = jobEnv(w.env, name)
+	cmd.Stderr = log
+	cmd.ExtraFiles = []*os.File{lock}
+	detach(cmd)
+
+	if err = cmd.Start(); err != nil {
+		return
+	}
+
+	dlog.Printf("Started job '%s' (%d)", name, cmd.Process.Pid)
+
+	// Reap the process if it exits before the workflow does
+	go cmd.Wait()
+
+	pid := strconv.Itoa(cmd.Process.Pid)
+	return writeFileAtomic(jobFile(dir, name, ".pid"), []byte(pid), 0600)
+}
+
+// IsRunning indicates whether the named background job is running
+func (w *Workflow) IsRunning(name string) bool {
+	dir, err := w.jobDir()
+	if err != nil {
+		return false
+	}
+
+	unlock, err := lockFile(path.Join(dir, ".lock"), true)
+	if err != nil {
+		return false
+	}
+	defer unlock()
+
+	return w.jobRunning(dir, name)
+}
+
+// support -------------------------------------------------------------------
+
+// jobDir returns the directory that holds job files, creating it if
+// necessary
+func (w *Workflow) jobDir() (dir string, err error) {
+	if w.cacheDir == "" {
+		return "", fmt.Errorf("no cache directory")
+	}
+	dir = path.Join(w.cacheDir, "jobs")
+	err = os.MkdirAll(dir, 0755)
+	return
+}
+
+// jobFile returns the name of one of a job's files
+func jobFile(dir, name, ext string) string {
+	return path.Join(dir, escapeKey(name)+ext)
+}
+
+// jobRunning indicates whether a job holds its lock. The PID file of a job
+// that isn't running is removed. The job directory must be locked.
+func (w *Workflow) jobRunning(dir, name string) bool {
+	if !lockingSupported {
+		return w.jobPID(dir, name) != 0
+	}
+
+	lock, ok, err := tryLockFile(jobFile(dir, name, ".lock"))
+	if err != nil {
+		return false
+	}
+	if !ok {
+		return true
+	}
+	lock.Close()
+
+	os.Remove(jobFile(dir, name, ".pid"))
+	return false
+}
+
+// jobPID returns the PID recorded for a job, or 0 if there's no PID or no
+// process with that PID. It's only used where advisory locks aren't
+// supported, since a PID may have been reused.
+func (w *Workflow) jobPID(dir, name string) int {
+	data, err := os.ReadFile(jobFile(dir, name, ".pid"))
+	if err != nil {
+		return 0
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || !processExists(pid) {
+		return 0
+	}
+
+	return pid
+}
+
+// jobEnv returns the environment for a job: the workflow's environment
+// layered over the process environment, plus the job's name
+func jobEnv(env Env, name string) (vars []string) {
+	merged := map[string]string{}
+	for _, v := range os.Environ() {
+		if parts := strings.SplitN(v, "=", 2); len(parts) == 2 {
+			merged[parts[0]] = parts[1]
+		}
+	}
+	for k, v := range env {
+		merged[k] = v
+	}
+	merged["alfred_job"] = name
+
+	for k, v := range merged {
+		vars = append(vars, k+"="+v)
+	}
+	sort.Strings(vars)
+	return
+}
@@ -0,0 +1,103 @@
+package alfred
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestJobHelper is run as a background job by the job tests
+func TestJobHelper(t *testing.T) {
+	switch os.Getenv("alfred_job") {
+	case "sleep":
+		time.Sleep(300 * time.Millisecond)
+	case "env":
+		cache := os.Getenv("alfred_workflow_cache")
+		os.WriteFile(path.Join(cache, "env.txt"), []byte(os.Getenv("alfred_workflow_data")), 0600)
+	default:
+		t.Skip("only run as a background job")
+	}
+}
+
+func TestRunInBackground(t *testing.T) {
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_workflow_cache": t.TempDir()}, false)
+
+	if w.IsRunning("sleep") {
+		t.Fatal("job is running before it was started")
+	}
+
+	if err := w.RunInBackground("sleep", "-test.run=^TestJobHelper$"); err != nil {
+		t.Fatal(err)
+	}
+	if !w.IsRunning("sleep") {
+		t.Fatal("job isn't running")
+	}
+
+	dir, _ := w.jobDir()
+	pid, _ := os.ReadFile(jobFile(dir, "sleep", ".pid"))
+
+	// A running job isn't started again
+	if err := w.RunInBackground("sleep", "-test.run=^TestJobHelper$"); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(jobFile(dir, "sleep", ".pid")); string(again) != string(pid) {
+		t.Error("job was started again")
+	}
+
+	waitForJob(t, &w, "sleep")
+
+	// The PID file of a finished job is removed
+	if _, err := os.Stat(jobFile(dir, "sleep", ".pid")); !os.IsNotExist(err) {
+		t.Errorf("PID file wasn't removed: %v", err)
+	}
+}
+
+func TestJobPIDReuse(t *testing.T) {
+	if !lockingSupported {
+		t.Skip("advisory locks aren't supported")
+	}
+
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_workflow_cache": t.TempDir()}, false)
+	dir, _ := w.jobDir()
+
+	// A stale PID file whose PID belongs to another process
+	pidFile := jobFile(dir, "stale", ".pid")
+	os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0600)
+
+	if w.IsRunning("stale") {
+		t.Error("job with a reused PID is running")
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Errorf("stale PID file wasn't removed: %v", err)
+	}
+}
+
+func TestJobEnv(t *testing.T) {
+	cache := t.TempDir()
+	w, _ := OpenWorkflowWithEnv(".", Env{
+		"alfred_workflow_cache": cache,
+		"alfred_workflow_data":  "/injected/data",
+	}, false)
+
+	if err := w.RunInBackground("env", "-test.run=^TestJobHelper$"); err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, &w, "env")
+
+	if data, err := os.ReadFile(path.Join(cache, "env.txt")); err != nil || string(data) != "/injected/data" {
+		t.Errorf("job got data dir (%q, %v), want the injected one", data, err)
+	}
+}
+
+// waitForJob waits for a background job to finish
+func waitForJob(t *testing.T, w *Workflow, name string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); w.IsRunning(name); {
+		if time.Now().After(deadline) {
+			t.Fatalf("job '%s' didn't finish", name)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
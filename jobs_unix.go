@@ -0,0 +1,20 @@
+//go:build !windows
+
+package alfred
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach makes a command run in its own session so that it isn't stopped
+// along with the workflow
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// processExists indicates whether a process is running
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
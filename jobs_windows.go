@@ -0,0 +1,27 @@
+//go:build windows
+
+package alfred
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// detach makes a command run in its own process group so that it isn't
+// stopped along with the workflow
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// processExists indicates whether a process is running
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
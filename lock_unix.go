@@ -0,0 +1,55 @@
+//go:build !windows
+
+package alfred
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an advisory lock on a file, creating it if necessary. The
+// returned function releases the lock.
+func lockFile(filename string, exclusive bool) (unlock func(), err error) {
+	var file *os.File
+	if file, err = os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600); err != nil {
+		return
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	if err = syscall.Flock(int(file.Fd()), how); err != nil {
+		file.Close()
+		return
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// tryLockFile takes an exclusive advisory lock on a file, creating it if
+// necessary, without waiting for other processes to release their locks. If
+// another process holds a lock, ok is false. The lock is released when the
+// file is closed, or when every process that inherited it has exited.
+func tryLockFile(filename string) (file *os.File, ok bool, err error) {
+	if file, err = os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600); err != nil {
+		return
+	}
+
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+		file.Close()
+		return nil, false, nil
+	} else if err != nil {
+		file.Close()
+		return nil, false, err
+	}
+
+	return file, true, nil
+}
+
+// lockingSupported indicates whether lock files are actually locked
+const lockingSupported = true
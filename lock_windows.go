@@ -0,0 +1,27 @@
+//go:build windows
+
+package alfred
+
+import "os"
+
+// lockFile creates a lock file. Advisory locks aren't supported on Windows, so
+// the file isn't actually locked.
+func lockFile(filename string, exclusive bool) (unlock func(), err error) {
+	var file *os.File
+	if file, err = os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600); err != nil {
+		return
+	}
+	return func() { file.Close() }, nil
+}
+
+// tryLockFile creates a lock file. Advisory locks aren't supported on
+// Windows, so the lock always appears to be available.
+func tryLockFile(filename string) (file *os.File, ok bool, err error) {
+	if file, err = os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600); err != nil {
+		return
+	}
+	return file, true, nil
+}
+
+// lockingSupported indicates whether lock files are actually locked
+const lockingSupported = false
@@ -5,20 +5,15 @@ package alfred
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
-	"os/user"
-	"path"
-	"regexp"
 	"strings"
 )
 
 var dlog = log.New(os.Stderr, "[alfred] ", log.LstdFlags)
-var appName string
 
 //
 // Public API
@@ -28,8 +23,9 @@ const (
 	// Line is an underline
 	Line = "–––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––––"
 
-	// MinAlfredVersion is the minimum supported version of Alfred
-	MinAlfredVersion = "3.1"
+	// MinAlfredVersion is the minimum supported version of Alfred. Alfred 2
+	// is sent XML responses (see XMLEncoder).
+	MinAlfredVersion = "2.0"
 )
 
 // CleanSplitN trims leading and trailing whitespace from a string, splits it
@@ -60,7 +56,11 @@ func LoadJSON(filename string, structure interface{}) error {
 	return dec.Decode(&structure)
 }
 
-// RunScript runs an arbitrary AppleScript.
+// RunScript runs an arbitrary AppleScript. The result is returned in source
+// form (osascript -s s).
+//
+// Deprecated: Use Workflow.RunScript, which supports arguments, timeouts, and
+// JavaScript for Automation.
 func RunScript(script string) (string, error) {
 	dlog.Printf("Running script %s", script)
 	raw, err := exec.Command("osascript", "-s", "s", "-e", script).CombinedOutput()
@@ -120,101 +120,13 @@ func TrimAllLeft(parts []string) []string {
 
 // support -------------------------------------------------------------------
 
-// Ensure the workflow environment is initialized
+// Configure logging for the workflow environment
 func init() {
 	if !IsDebugging() {
 		// If a debugging panel isn't open, disable logging
 		dlog.SetOutput(io.Discard)
 		dlog.SetFlags(0)
 	}
-
-	version := os.Getenv("alfred_version")
-	dlog.Printf("Alfred version: %s", version)
-
-	if version == "" {
-		// If alfred_version wasn't present in the environment, initialize it manually
-
-		plFile := path.Join("workflow", "info.plist")
-		if !fileExists(plFile) {
-			plFile = "info.plist"
-		}
-		if !fileExists(plFile) {
-			fmt.Println("alfred must be run in a workflow directory")
-			os.Exit(1)
-		}
-
-		plData := LoadPlist(plFile)
-		bundleID := plData["bundleid"].(string)
-		name := plData["name"].(string)
-
-		os.Setenv("alfred_workflow_bundleid", bundleID)
-		os.Setenv("alfred_workflow_name", name)
-
-		dlog.Printf("Looking for app in /Applications")
-		var version string
-		files, _ := os.ReadDir("/Applications")
-		matcher := regexp.MustCompile(`Alfred( \d+)?.app`)
-		var appname string
-		for _, file := range files {
-			fname := file.Name()
-			if fname[0] < 'A' {
-				dlog.Printf("Ignoring %s", fname)
-				continue
-			}
-			if fname[0] > 'A' {
-				dlog.Printf("Ignoring %s", fname)
-				break
-			}
-			if matcher.MatchString(fname) && fname > appname {
-				dlog.Printf("Using %s", fname)
-				appname = fname
-			}
-		}
-
-		if appname != "" {
-			dlog.Printf("Found app at %s", appname)
-			appname = strings.TrimSuffix(appname, ".app")
-			parts := strings.Split(appname, " ")
-			if len(parts) == 2 {
-				version = parts[1]
-				dlog.Printf("Using app version %s", version)
-				os.Setenv("alfred_short_version", version)
-			}
-		} else {
-			dlog.Fatal("Could not find Alfred app")
-		}
-
-		if version == "" {
-			dlog.Fatal("Could not determine Alfred version")
-		}
-
-		var u *user.User
-		var err error
-		if u, err = user.Current(); err != nil {
-			dlog.Fatal("Error getting user:", err)
-		}
-
-		cacheDir := path.Join(u.HomeDir, "Library", "Caches", "com.runningwithcrayons.Alfred-"+version, "Workflow Data", bundleID)
-		os.Setenv("alfred_workflow_cache", cacheDir)
-
-		dataDir := path.Join(u.HomeDir, "Library", "Application Support", "Alfred "+version, "Workflow Data", bundleID)
-		os.Setenv("alfred_workflow_data", dataDir)
-	} else {
-		if !checkVersion(version) {
-			message := fmt.Sprintf("This workflow requires Alfred %s+", MinAlfredVersion)
-
-			if version[0] == '2' {
-				fmt.Printf(`<?xml version="1.0"?><items><item><title>%s</title></item></items>`, message)
-			} else {
-				fmt.Printf(`{"items":[{"title":"%s"}]}`, message)
-			}
-			dlog.Fatalf(message)
-		}
-
-		os.Setenv("alfred_short_version", strings.SplitN(version, ".", 2)[0])
-	}
-
-	appName = "Alfred " + os.Getenv("alfred_short_version")
 }
 
 // checkVersion returns true if a given version is greater than or equal to the minimum supported alfred version
@@ -234,17 +146,6 @@ func checkVersion(version string) bool {
 	return true
 }
 
-func parseDialogResponse(response string) (button string, text string) {
-	var parser = regexp.MustCompile(`{button returned:"(\w*)"(?:, text returned:"(.*)")?}`)
-	parts := parser.FindStringSubmatch(response)
-	if parts != nil {
-		button = parts[1]
-		text = strings.Replace(parts[2], `\"`, `"`, -1)
-	}
-	dlog.Printf(`Parsed response: button=%s, text=%s`, button, text)
-	return
-}
-
 func fileExists(dir string) bool {
 	stat, err := os.Stat(dir)
 	return !os.IsNotExist(err) && !stat.IsDir()
@@ -0,0 +1,142 @@
+package alfred
+
+import "context"
+
+// Invocation describes a call to a Filter's Items method or an Action's Do
+// method
+type Invocation struct {
+	// Keyword is the keyword path of the command being called
+	Keyword string
+	// Command is the Filter or Action being called
+	Command Command
+	// Def is the command's definition
+	Def CommandDef
+	// Mode is the workflow mode, ModeTell for Filters and ModeDo for Actions
+	Mode ModeType
+	// Mod is the modifier key that was held when the calling item was
+	// actioned, if any
+	Mod ModKey
+	// Arg is the query passed to a Filter
+	Arg string
+	// Data is the keyword-specific data string
+	Data string
+}
+
+// FilterHandler generates items for a Filter invocation
+type FilterHandler func(ctx context.Context, inv *Invocation) ([]Item, error)
+
+// ActionHandler runs an Action invocation
+type ActionHandler func(ctx context.Context, inv *Invocation) (string, error)
+
+// Middleware wraps Filter and Action invocations. Each function receives the
+// next handler in the chain and returns a handler that will be called in its
+// place. A middleware may modify the Invocation before calling next, inspect
+// or replace the result, or skip next entirely. Either function may be nil.
+type Middleware struct {
+	Filter func(next FilterHandler) FilterHandler
+	Action func(next ActionHandler) ActionHandler
+}
+
+// Use adds middleware to a workflow. Middleware is applied in the order it's
+// added, so the first middleware added is the outermost.
+func (w *Workflow) Use(m ...Middleware) {
+	w.middleware = append(w.middleware, m...)
+}
+
+// support -------------------------------------------------------------------
+
+// invokeFilter calls a Filter through the workflow's middleware. The
+// command's timeout applies to the whole chain; if the context is done before
+// the chain returns, it's abandoned and an error is returned.
+func (w *Workflow) invokeFilter(ctx context.Context, inv *Invocation) ([]Item, error) {
+	type result struct {
+		items []Item
+		err   error
+		panic *panicError
+	}
+
+	parent := ctx
+	ctx, cancel := commandContext(ctx, inv.Def)
+	defer cancel()
+
+	handler := FilterHandler(func(ctx context.Context, inv *Invocation) ([]Item, error) {
+		return callFilter(ctx, inv.Command, inv.Arg, inv.Data)
+	})
+
+	for i := len(w.middleware) - 1; i >= 0; i-- {
+		if m := w.middleware[i]; m.Filter != nil {
+			handler = m.Filter(handler)
+		}
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- result{panic: capturePanic(p)}
+			}
+		}()
+
+		var r result
+		r.items, r.err = handler(ctx, inv)
+		done <- r
+	}()
+
+	select {
+	case r := <-done:
+		if r.panic != nil {
+			panic(r.panic)
+		}
+		return r.items, r.err
+	case <-ctx.Done():
+		return nil, commandError(inv.Def, ctx.Err(), parent.Err() == nil)
+	}
+}
+
+// invokeAction runs an Action through the workflow's middleware. The
+// command's timeout applies to the whole chain; if the context is done before
+// the chain returns, it's abandoned and an error is returned.
+func (w *Workflow) invokeAction(ctx context.Context, inv *Invocation) (string, error) {
+	type result struct {
+		output string
+		err    error
+		panic  *panicError
+	}
+
+	parent := ctx
+	ctx, cancel := commandContext(ctx, inv.Def)
+	defer cancel()
+
+	handler := ActionHandler(func(ctx context.Context, inv *Invocation) (string, error) {
+		return callAction(ctx, inv.Command, inv.Data)
+	})
+
+	for i := len(w.middleware) - 1; i >= 0; i-- {
+		if m := w.middleware[i]; m.Action != nil {
+			handler = m.Action(handler)
+		}
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- result{panic: capturePanic(p)}
+			}
+		}()
+
+		var r result
+		r.output, r.err = handler(ctx, inv)
+		done <- r
+	}()
+
+	select {
+	case r := <-done:
+		if r.panic != nil {
+			panic(r.panic)
+		}
+		return r.output, r.err
+	case <-ctx.Done():
+		return "", commandError(inv.Def, ctx.Err(), parent.Err() == nil)
+	}
+}
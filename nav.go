@@ -0,0 +1,132 @@
+package alfred
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BackItem returns an item that returns to the previous view on the
+// navigation stack. Its subtitle names the view it returns to. If there's no
+// previous view, the item isn't actionable.
+func (w *Workflow) BackItem() Item {
+	item := Item{Title: "Back"}
+
+	if crumbs := w.Breadcrumbs(); len(crumbs) > 1 {
+		item.Subtitle = fmt.Sprintf("Return to %s", crumbs[len(crumbs)-2])
+		item.Arg = &ItemArg{Mode: ModeBack}
+	} else {
+		item.Subtitle = "Nothing to go back to"
+	}
+
+	return item
+}
+
+// BackMod returns an ItemMod that returns to the previous view on the
+// navigation stack. It can be added to any item with AddMod. If there's no
+// previous view, the mod isn't actionable.
+func (w *Workflow) BackMod() ItemMod {
+	if crumbs := w.Breadcrumbs(); len(crumbs) > 1 {
+		return ItemMod{
+			Subtitle: fmt.Sprintf("Back to %s", crumbs[len(crumbs)-2]),
+			Arg:      &ItemArg{Mode: ModeBack},
+		}
+	}
+	return ItemMod{Subtitle: "Nothing to go back to"}
+}
+
+// Breadcrumbs returns the titles of the views on the navigation stack,
+// starting with the oldest and ending with the current view. A Filter can use
+// them to show the user where they are (e.g., in a subtitle).
+//
+// Breadcrumbs only has an effect while the workflow is running.
+func (w *Workflow) Breadcrumbs() (crumbs []string) {
+	s := w.state
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// Views without a title are the top level of the workflow
+	for _, frame := range s.stack {
+		title := frame.Title
+		if title == "" {
+			title = w.name
+		}
+		crumbs = append(crumbs, title)
+	}
+
+	if s.title != "" {
+		crumbs = append(crumbs, s.title)
+	} else if len(crumbs) > 0 {
+		crumbs = append(crumbs, w.name)
+	}
+
+	return
+}
+
+// support -------------------------------------------------------------------
+
+// navFrame is a view on the navigation stack
+type navFrame struct {
+	Keyword string `json:"keyword,omitempty"`
+	Arg     string `json:"arg,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Title   string `json:"title,omitempty"`
+}
+
+// push adds a view to the top of the navigation stack. The stack is copied so
+// that other copies of the data aren't affected.
+func (d *workflowData) push(view workflowData) {
+	title := view.Title
+	if title == "" {
+		title = view.Keyword
+	}
+
+	stack := make([]navFrame, len(view.Stack), len(view.Stack)+1)
+	copy(stack, view.Stack)
+	d.Stack = append(stack, navFrame{
+		Keyword: view.Keyword,
+		Arg:     view.Arg,
+		Data:    view.Data,
+		Title:   title,
+	})
+}
+
+// back replaces the data with the previous view, returning the query the view
+// had. Without a navigation stack, Data may hold the previous view's data;
+// otherwise, the previous view is the keyword menu.
+func (d *workflowData) back() (arg string) {
+	if len(d.Stack) > 0 {
+		return d.pop()
+	}
+
+	var prev workflowData
+	if err := json.Unmarshal([]byte(d.Data), &prev); err != nil {
+		prev = workflowData{}
+	}
+	if prev.Mode == "" || prev.Mode == ModeBack {
+		prev.Mode = ModeTell
+	}
+
+	*d = prev
+	return
+}
+
+// pop replaces the data with the view at the top of the navigation stack,
+// returning the query the view had when it was pushed
+func (d *workflowData) pop() (arg string) {
+	n := len(d.Stack)
+	frame := d.Stack[n-1]
+
+	*d = workflowData{
+		Keyword: frame.Keyword,
+		Mode:    ModeTell,
+		Data:    frame.Data,
+		Title:   frame.Title,
+		Stack:   d.Stack[:n-1],
+	}
+
+	return frame.Arg
+}
@@ -0,0 +1,160 @@
+package alfred
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPushPop(t *testing.T) {
+	view := workflowData{Keyword: "notes", Data: "d1", Arg: "q1"}
+
+	var next workflowData
+	next.push(view)
+	next.Keyword, next.Title = "note", "Note 1"
+
+	var last workflowData
+	last.push(next)
+	last.Arg = "ignored"
+
+	want := []navFrame{
+		{Keyword: "notes", Arg: "q1", Data: "d1", Title: "notes"},
+		{Keyword: "note", Title: "Note 1"},
+	}
+	if !reflect.DeepEqual(last.Stack, want) {
+		t.Fatalf("got stack %+v, want %+v", last.Stack, want)
+	}
+
+	// Pushing must not modify the stack of the view that was pushed
+	if len(next.Stack) != 1 {
+		t.Errorf("pushed view's stack was modified: %+v", next.Stack)
+	}
+
+	if arg := last.pop(); arg != "" || last.Keyword != "note" || last.Title != "Note 1" {
+		t.Errorf("first pop: got %q, %+v", arg, last)
+	}
+	if arg := last.pop(); arg != "q1" || last.Keyword != "notes" || last.Data != "d1" || len(last.Stack) != 0 {
+		t.Errorf("second pop: got %q, %+v", arg, last)
+	}
+	if last.Mode != ModeTell {
+		t.Errorf("got mode %q, want %q", last.Mode, ModeTell)
+	}
+}
+
+func TestBack(t *testing.T) {
+	tests := []struct {
+		name string
+		data workflowData
+		want workflowData
+		arg  string
+	}{
+		{
+			"stack",
+			workflowData{Mode: ModeBack, Stack: []navFrame{{Keyword: "a", Arg: "q"}}},
+			workflowData{Keyword: "a", Mode: ModeTell, Stack: []navFrame{}},
+			"q",
+		},
+		{
+			"legacy data",
+			workflowData{Keyword: "b", Mode: ModeBack, Data: `{"keyword":"a","data":"x"}`},
+			workflowData{Keyword: "a", Mode: ModeTell, Data: "x"},
+			"",
+		},
+		{
+			"nothing",
+			workflowData{Keyword: "b", Mode: ModeBack},
+			workflowData{Mode: ModeTell},
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.data
+			arg := data.back()
+			if arg != test.arg || !reflect.DeepEqual(data, test.want) {
+				t.Errorf("got (%q, %+v), want (%q, %+v)", arg, data, test.arg, test.want)
+			}
+		})
+	}
+}
+
+func TestBackWithoutStack(t *testing.T) {
+	commands := []Command{testFilter{"list"}}
+	w := testWorkflow()
+
+	// A back item in a view without a previous view isn't actionable
+	back := w.BackItem()
+	if back.Arg != nil {
+		t.Errorf("back item has an arg: %+v", back.Arg)
+	}
+
+	// Going back with nothing to go back to shows the keyword menu
+	r := runTell(t, &w, commands, "", `{"mode":"back"}`)
+	if got, want := titles(r), []string{"list"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	want := `-trigger {"alfredworkflow":{"arg":"","variables":{"data":"{\"mode\":\"tell\"}"}}}`
+	if got := runTest(t, &w, commands, "-final", `{"mode":"back"}`); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// pushFilter returns an item that pushes a view of another command
+type pushFilter struct {
+	keyword    string
+	searchable bool
+}
+
+func (f pushFilter) About() CommandDef {
+	return CommandDef{Keyword: f.keyword, IsEnabled: true, Searchable: f.searchable}
+}
+
+func (f pushFilter) Items(arg, data string) ([]Item, error) {
+	return []Item{{
+		Title: f.keyword + " " + arg,
+		Arg:   &ItemArg{Keyword: "detail", Data: arg, Push: true, Title: "Detail"},
+	}}, nil
+}
+
+func TestPushFromSearch(t *testing.T) {
+	commands := []Command{pushFilter{keyword: "notes", searchable: true}}
+	w := testWorkflow()
+	w.GlobalSearch = true
+
+	r := runTell(t, &w, commands, "zz")
+
+	var data workflowData
+	for _, item := range r.Items {
+		if item.Title == "notes zz" {
+			json.Unmarshal([]byte(item.Arg), &data)
+		}
+	}
+
+	want := []navFrame{{Arg: "zz"}}
+	if data.Keyword != "detail" || !reflect.DeepEqual(data.Stack, want) {
+		t.Fatalf("got %+v, want keyword 'detail' and stack %+v", data, want)
+	}
+
+	// Going back returns to the search with the original query
+	out := runTest(t, &w, commands, "-final", `{"mode":"back","stack":[{"arg":"zz"}]}`)
+	if want := `-trigger {"alfredworkflow":{"arg":"zz","variables":{"data":"{\"mode\":\"tell\"}"}}}`; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestPushFromFilter(t *testing.T) {
+	commands := []Command{pushFilter{keyword: "notes"}}
+	w := testWorkflow()
+
+	r := runTell(t, &w, commands, "  foo ", `{"keyword":"notes","data":"d"}`)
+
+	var data workflowData
+	json.Unmarshal([]byte(r.Items[0].Arg), &data)
+
+	want := []navFrame{{Keyword: "notes", Arg: "foo", Data: "d", Title: "notes"}}
+	if data.Title != "Detail" || !reflect.DeepEqual(data.Stack, want) {
+		t.Errorf("got %+v, want stack %+v", data, want)
+	}
+}
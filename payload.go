@@ -0,0 +1,145 @@
+package alfred
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Validator is implemented by payload types that can check their own
+// contents. DecodeData calls Validate after decoding a payload.
+type Validator interface {
+	Validate() error
+}
+
+// DataTyper is implemented by payload types that provide their own type name.
+// A stable name lets payloads that were already sent to Alfred be decoded
+// after the type has been renamed or moved. By default, a type's package path
+// and name are used.
+type DataTyper interface {
+	DataType() string
+}
+
+// DataError is returned by DecodeData when data can't be decoded as the
+// requested type
+type DataError struct {
+	// Want is the name of the requested type
+	Want string
+	// Got is the name of the type the data was encoded as, if known
+	Got string
+	// Err is the underlying decoding or validation error, if any
+	Err error
+}
+
+// Error returns a string describing a DataError
+func (e *DataError) Error() string {
+	if e.Got != "" && e.Got != e.Want {
+		return fmt.Sprintf("data holds a %s, expected a %s", e.Got, e.Want)
+	}
+	return fmt.Sprintf("invalid %s data: %v", e.Want, e.Err)
+}
+
+// Unwrap returns the error underlying a DataError
+func (e *DataError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeData encodes a value as a typed payload suitable for ItemArg.Data
+func EncodeData[T any](v T) (data string, err error) {
+	var value []byte
+	if value, err = json.Marshal(v); err != nil {
+		return
+	}
+
+	var encoded []byte
+	if encoded, err = json.Marshal(payload{Type: typeName[T](), Value: value}); err != nil {
+		return
+	}
+
+	return string(encoded), nil
+}
+
+// NewArg returns an ItemArg whose Data is a typed payload holding v. The
+// target Command can recover v with DecodeData. NewArg panics if v can't be
+// encoded as JSON.
+func NewArg[T any](keyword string, mode ModeType, v T) *ItemArg {
+	data, err := EncodeData(v)
+	if err != nil {
+		panic(fmt.Errorf("error encoding %s data: %v", typeName[T](), err))
+	}
+
+	return &ItemArg{
+		Keyword: keyword,
+		Mode:    mode,
+		Data:    data,
+	}
+}
+
+// DecodeData decodes a payload created by NewArg or EncodeData. Plain JSON
+// data (e.g., from an older version of a workflow) is decoded directly. A
+// *DataError is returned if the data holds a different type, has fields T
+// doesn't know about, or fails validation.
+func DecodeData[T any](data string) (v T, err error) {
+	want := typeName[T]()
+
+	if data == "" {
+		err = &DataError{Want: want, Err: errors.New("no data")}
+		return
+	}
+
+	var p payload
+	if err = strictUnmarshal([]byte(data), &p); err != nil || p.Type == "" || p.Value == nil {
+		// Not a payload; try the data as plain JSON
+		p = payload{Type: want, Value: json.RawMessage(data)}
+	}
+
+	if p.Type != want {
+		err = &DataError{Want: want, Got: p.Type}
+		return
+	}
+
+	if err = strictUnmarshal(p.Value, &v); err != nil {
+		err = &DataError{Want: want, Err: err}
+		return
+	}
+
+	if validator, ok := interface{}(&v).(Validator); ok {
+		if err = validator.Validate(); err != nil {
+			err = &DataError{Want: want, Err: err}
+		}
+	}
+
+	return
+}
+
+// support -------------------------------------------------------------------
+
+// payload is the envelope that holds typed data in ItemArg.Data. The field
+// names are unlikely to clash with plain JSON data.
+type payload struct {
+	Type  string          `json:"$type"`
+	Value json.RawMessage `json:"$value"`
+}
+
+// typeName returns the name a type is recorded under in a payload
+func typeName[T any]() string {
+	var v T
+	if typer, ok := interface{}(&v).(DataTyper); ok {
+		return typer.DataType()
+	}
+
+	t := reflect.TypeOf(&v).Elem()
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
+
+// strictUnmarshal unmarshals JSON data, rejecting unknown fields
+func strictUnmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,79 @@
+package alfred
+
+import (
+	"errors"
+	"testing"
+)
+
+type testNote struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+}
+
+func (n *testNote) Validate() error {
+	if n.ID == 0 {
+		return errors.New("missing id")
+	}
+	return nil
+}
+
+type testTask struct {
+	ID int `json:"id"`
+}
+
+type testTagged struct {
+	ID int `json:"id"`
+}
+
+func (testTagged) DataType() string { return "tagged" }
+
+func TestDecodeData(t *testing.T) {
+	note := NewArg("note", ModeDo, testNote{Type: "note", ID: 1}).Data
+
+	tests := []struct {
+		name string
+		data string
+		want testNote
+		err  string
+	}{
+		{"payload", note, testNote{"note", 1}, ""},
+		{"plain JSON", `{"type":"note","id":2}`, testNote{"note", 2}, ""},
+		{"other type", NewArg("", "", testTask{ID: 1}).Data, testNote{}, "data holds a github.com/jason0x43/go-alfred.testTask, expected a github.com/jason0x43/go-alfred.testNote"},
+		{"unknown field", `{"id":1,"name":"x"}`, testNote{}, `invalid github.com/jason0x43/go-alfred.testNote data: json: unknown field "name"`},
+		{"invalid", `{"type":"note"}`, testNote{}, "invalid github.com/jason0x43/go-alfred.testNote data: missing id"},
+		{"empty", "", testNote{}, "invalid github.com/jason0x43/go-alfred.testNote data: no data"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DecodeData[testNote](test.data)
+			if test.err != "" {
+				var de *DataError
+				if !errors.As(err, &de) || err.Error() != test.err {
+					t.Errorf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeDataTypes(t *testing.T) {
+	if s, err := DecodeData[string](NewArg("", "", "hello").Data); err != nil || s != "hello" {
+		t.Errorf("string: got (%q, %v)", s, err)
+	}
+
+	data := NewArg("", "", testTagged{ID: 3}).Data
+	if want := `{"$type":"tagged","$value":{"id":3}}`; data != want {
+		t.Errorf("tagged: got %s, want %s", data, want)
+	}
+	if v, err := DecodeData[testTagged](data); err != nil || v.ID != 3 {
+		t.Errorf("tagged: got (%+v, %v)", v, err)
+	}
+}
@@ -13,15 +13,9 @@ type Plist map[string]interface{}
 // LoadPlist loads a plist from an XML file
 func LoadPlist(filename string) (p Plist) {
 	var err error
-	var xmlData []byte
-	if xmlData, err = os.ReadFile(filename); err != nil {
-		panic(fmt.Errorf("error reading plist file: %s", err))
-	}
-
-	if _, err = plist.Unmarshal(xmlData, &p); err != nil {
+	if p, err = readPlist(filename); err != nil {
 		panic(err)
 	}
-
 	return
 }
 
@@ -37,3 +31,16 @@ func SavePlist(filename string, p Plist) {
 		panic(err)
 	}
 }
+
+// support -------------------------------------------------------------------
+
+// readPlist loads a plist from an XML file, returning any errors
+func readPlist(filename string) (p Plist, err error) {
+	var xmlData []byte
+	if xmlData, err = os.ReadFile(filename); err != nil {
+		return nil, fmt.Errorf("error reading plist file: %s", err)
+	}
+
+	_, err = plist.Unmarshal(xmlData, &p)
+	return
+}
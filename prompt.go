@@ -0,0 +1,407 @@
+package alfred
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrCanceled is returned by a Prompter when the user cancels a prompt
+var ErrCanceled = errors.New("canceled by the user")
+
+// Prompter asks the user questions outside of Alfred's UI.
+type Prompter interface {
+	// Message shows the user a message
+	Message(message string) error
+	// Ask shows the user a message with a set of buttons, and returns the
+	// button that was chosen
+	Ask(message string, buttons []string, defaultButton string) (string, error)
+	// Input asks the user to enter a value. If hidden is true, the value
+	// isn't displayed as it's typed.
+	Input(prompt, defaultValue string, hidden bool) (string, error)
+	// Choose asks the user to choose from a list of options. If multiple is
+	// true, more than one option may be chosen.
+	Choose(prompt string, options []string, multiple bool) ([]string, error)
+}
+
+// AppleScriptPrompter shows prompts in macOS dialogs using AppleScript.
+// Prompts, titles, and options are passed to the scripts as arguments, so
+// they may contain any characters.
+type AppleScriptPrompter struct {
+	// Title is the title of the dialogs
+	Title string
+	// App is the application that shows the dialogs, such as "Alfred 5".
+	// Dialogs use the application's icon. If App is empty, dialogs are shown
+	// by osascript.
+	App string
+	// Runner runs the dialog scripts (default: an OsascriptRunner)
+	Runner ScriptRunner
+}
+
+// Message shows a message in a dialog with an Ok button
+func (p *AppleScriptPrompter) Message(message string) (err error) {
+	_, err = p.Ask(message, []string{"Ok"}, "Ok")
+	return
+}
+
+// Ask shows a message in a dialog with a set of buttons. A button named
+// "Cancel" cancels the dialog.
+func (p *AppleScriptPrompter) Ask(message string, buttons []string, defaultButton string) (button string, err error) {
+	if len(buttons) == 0 {
+		return "", errors.New("a dialog needs at least one button")
+	}
+	if defaultButton == "" {
+		defaultButton = buttons[len(buttons)-1]
+	}
+	return p.run(askScript, append([]string{message, defaultButton}, buttons...)...)
+}
+
+// Input asks the user to enter a value in a dialog with Cancel and Ok
+// buttons. A colon is added to the prompt, since it labels the text field.
+func (p *AppleScriptPrompter) Input(prompt, defaultValue string, hidden bool) (value string, err error) {
+	return p.run(inputScript, prompt+":", defaultValue, strconv.FormatBool(hidden))
+}
+
+// Choose asks the user to choose from a list of options
+func (p *AppleScriptPrompter) Choose(prompt string, options []string, multiple bool) (chosen []string, err error) {
+	if len(options) == 0 {
+		return nil, errors.New("there are no options to choose from")
+	}
+
+	var out string
+	if out, err = p.run(chooseScript, append([]string{prompt, strconv.FormatBool(multiple)}, options...)...); err != nil {
+		return
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// TerminalPrompter asks questions in a terminal. It's useful when running a
+// workflow from the command line.
+type TerminalPrompter struct {
+	// In is where answers are read from (default: os.Stdin)
+	In io.Reader
+	// Out is where prompts are written (default: os.Stderr, so prompts don't
+	// mix with output meant for Alfred)
+	Out io.Writer
+
+	once   sync.Once
+	reader *bufio.Reader
+}
+
+// Message writes a message
+func (p *TerminalPrompter) Message(message string) (err error) {
+	_, err = fmt.Fprintln(p.out(), message)
+	return
+}
+
+// Ask writes a message and a list of buttons, and reads the user's choice. A
+// button may be chosen by typing a prefix of its name. An empty answer
+// chooses the default button.
+func (p *TerminalPrompter) Ask(message string, buttons []string, defaultButton string) (button string, err error) {
+	labels := make([]string, len(buttons))
+	for i, b := range buttons {
+		labels[i] = b
+		if b == defaultButton {
+			labels[i] = "[" + b + "]"
+		}
+	}
+
+	for {
+		fmt.Fprintf(p.out(), "%s (%s) ", message, strings.Join(labels, "/"))
+
+		var answer string
+		if answer, err = p.readLine(); err != nil {
+			return
+		}
+		if answer == "" && defaultButton != "" {
+			return defaultButton, nil
+		}
+
+		for _, b := range buttons {
+			if answer != "" && strings.HasPrefix(strings.ToLower(b), strings.ToLower(answer)) {
+				return b, nil
+			}
+		}
+	}
+}
+
+// Input writes a prompt and reads a value. An empty answer chooses the
+// default value. Typing is hidden with stty when In is a terminal.
+func (p *TerminalPrompter) Input(prompt, defaultValue string, hidden bool) (value string, err error) {
+	if defaultValue != "" && !hidden {
+		fmt.Fprintf(p.out(), "%s [%s]: ", prompt, defaultValue)
+	} else {
+		fmt.Fprintf(p.out(), "%s: ", prompt)
+	}
+
+	if hidden {
+		if restore := p.hideInput(); restore != nil {
+			defer func() {
+				restore()
+				fmt.Fprintln(p.out())
+			}()
+		}
+	}
+
+	if value, err = p.readLine(); err == nil && value == "" {
+		value = defaultValue
+	}
+	return
+}
+
+// Choose writes a numbered list of options and reads the numbers of the
+// chosen options, separated by spaces or commas
+func (p *TerminalPrompter) Choose(prompt string, options []string, multiple bool) (chosen []string, err error) {
+	for i, option := range options {
+		fmt.Fprintf(p.out(), "%d) %s\n", i+1, option)
+	}
+
+	for {
+		fmt.Fprintf(p.out(), "%s: ", prompt)
+
+		var answer string
+		if answer, err = p.readLine(); err != nil {
+			return
+		}
+		if answer == "" {
+			return nil, ErrCanceled
+		}
+
+		if chosen = parseChoices(answer, options); chosen != nil && (multiple || len(chosen) == 1) {
+			return
+		}
+	}
+}
+
+// ScriptedPrompter is a Prompter that gives scripted answers. It's meant for
+// tests.
+type ScriptedPrompter struct {
+	// Answers are returned, in order, by the prompts. Message doesn't use an
+	// answer.
+	Answers []PromptAnswer
+	// Prompts records the prompts that were shown
+	Prompts []string
+}
+
+// PromptAnswer is a scripted answer to a prompt
+type PromptAnswer struct {
+	// Button is returned by Ask
+	Button string
+	// Value is returned by Input
+	Value string
+	// Chosen is returned by Choose
+	Chosen []string
+	// Canceled causes the prompt to return ErrCanceled
+	Canceled bool
+}
+
+// Message records a message
+func (p *ScriptedPrompter) Message(message string) error {
+	p.Prompts = append(p.Prompts, message)
+	return nil
+}
+
+// Ask records a message and returns the next answer's Button
+func (p *ScriptedPrompter) Ask(message string, buttons []string, defaultButton string) (string, error) {
+	answer, err := p.answer(message)
+	return answer.Button, err
+}
+
+// Input records a prompt and returns the next answer's Value
+func (p *ScriptedPrompter) Input(prompt, defaultValue string, hidden bool) (string, error) {
+	answer, err := p.answer(prompt)
+	return answer.Value, err
+}
+
+// Choose records a prompt and returns the next answer's Chosen options
+func (p *ScriptedPrompter) Choose(prompt string, options []string, multiple bool) ([]string, error) {
+	answer, err := p.answer(prompt)
+	return answer.Chosen, err
+}
+
+// support -------------------------------------------------------------------
+
+// errNoAnswer is returned by a ScriptedPrompter that has run out of answers
+var errNoAnswer = errors.New("no scripted answer for prompt")
+
+// prompter returns the workflow's Prompter
+func (w *Workflow) prompter() Prompter {
+	if w.Prompter != nil {
+		return w.Prompter
+	}
+
+	p := &AppleScriptPrompter{Title: w.name, Runner: w.scriptRunner()}
+	if version := w.env["alfred_short_version"]; version != "" {
+		p.App = "Alfred " + version
+	}
+	return p
+}
+
+// dialogScript runs the body of a dialog script, which sets answer from
+// params. Its args are the app showing the dialog, the dialog's title, and
+// the params. A dialog that's canceled raises error -128.
+const dialogScript = `on run argv
+	set appName to item 1 of argv
+	set theTitle to item 2 of argv
+	set params to items 3 thru -1 of argv
+
+	if appName is "" then
+		set theApp to current application
+		set theIcon to note
+	else
+		set theApp to application appName
+		tell theApp to activate
+		set appPath to (path to application appName)
+		set theIcon to path to resource "appicon.icns" in bundle (appPath as alias)
+	end if
+
+	tell theApp
+		try
+%s
+		on error number -128
+			return "cancel"
+		end try
+	end tell
+
+	return "ok" & linefeed & answer
+end run`
+
+// askScript shows a dialog; its params are the message, the default
+// button, and the buttons
+var askScript = fmt.Sprintf(dialogScript, `
+			set r to display dialog (item 1 of params) with title theTitle buttons (items 3 thru -1 of params) default button (item 2 of params) with icon theIcon
+			set answer to button returned of r`)
+
+// inputScript shows a dialog with a text field; its params are the prompt,
+// the default value, and whether the answer is hidden
+var inputScript = fmt.Sprintf(dialogScript, `
+			set r to display dialog (item 1 of params) with title theTitle default answer (item 2 of params) buttons {"Cancel", "Ok"} default button "Ok" cancel button "Cancel" hidden answer (item 3 of params is "true") with icon theIcon
+			set answer to text returned of r`)
+
+// chooseScript shows a list; its params are the prompt, whether multiple
+// selections are allowed, and the options
+var chooseScript = fmt.Sprintf(dialogScript, `
+			set r to choose from list (items 3 thru -1 of params) with title theTitle with prompt (item 1 of params) multiple selections allowed (item 2 of params is "true")
+			if r is false then error number -128
+			set AppleScript's text item delimiters to linefeed
+			set answer to r as text`)
+
+// run runs a dialog script with the given params and returns the answer
+func (p *AppleScriptPrompter) run(source string, params ...string) (out string, err error) {
+	runner := p.Runner
+	if runner == nil {
+		runner = &OsascriptRunner{}
+	}
+
+	script := Script{
+		Source: source,
+		Args:   append([]string{p.App, p.Title}, params...),
+	}
+
+	if out, err = runner.RunScript(script); err != nil {
+		return
+	}
+	return parsePromptResult(out)
+}
+
+// parsePromptResult parses the output of a dialog script, which is "cancel"
+// or "ok" followed by the answer on the next line
+func parsePromptResult(out string) (string, error) {
+	if out == "cancel" {
+		return "", ErrCanceled
+	}
+	if out == "ok" {
+		// An empty answer's newline was trimmed with the output's
+		return "", nil
+	}
+	if answer := strings.TrimPrefix(out, "ok\n"); answer != out {
+		return answer, nil
+	}
+	return "", fmt.Errorf("unexpected dialog result '%s'", out)
+}
+
+// out returns the writer prompts are written to
+func (p *TerminalPrompter) out() io.Writer {
+	if p.Out == nil {
+		return os.Stderr
+	}
+	return p.Out
+}
+
+// readLine reads an answer. Reaching the end of the input cancels the prompt.
+func (p *TerminalPrompter) readLine() (line string, err error) {
+	p.once.Do(func() {
+		in := p.In
+		if in == nil {
+			in = os.Stdin
+		}
+		p.reader = bufio.NewReader(in)
+	})
+
+	line, err = p.reader.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", ErrCanceled
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// hideInput turns off terminal echo if In is a terminal, and returns a
+// function that turns it back on
+func (p *TerminalPrompter) hideInput() (restore func()) {
+	in, ok := p.In.(*os.File)
+	if p.In == nil {
+		in, ok = os.Stdin, true
+	}
+	if !ok {
+		return nil
+	}
+
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = in
+		return cmd.Run()
+	}
+
+	if err := stty("-echo"); err != nil {
+		return nil
+	}
+	return func() { stty("echo") }
+}
+
+// parseChoices converts an answer containing option numbers into the chosen
+// options. It returns nil if the answer isn't valid.
+func parseChoices(answer string, options []string) (chosen []string) {
+	fields := strings.FieldsFunc(answer, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	for _, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 || n > len(options) {
+			return nil
+		}
+		chosen = append(chosen, options[n-1])
+	}
+	return
+}
+
+// answer records a prompt and returns the next scripted answer
+func (p *ScriptedPrompter) answer(prompt string) (answer PromptAnswer, err error) {
+	p.Prompts = append(p.Prompts, prompt)
+
+	if len(p.Answers) == 0 {
+		return answer, fmt.Errorf("%w '%s'", errNoAnswer, prompt)
+	}
+
+	answer, p.Answers = p.Answers[0], p.Answers[1:]
+	if answer.Canceled {
+		err = ErrCanceled
+	}
+	return
+}
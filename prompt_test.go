@@ -0,0 +1,151 @@
+package alfred
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTerminalPrompter(t *testing.T) {
+	var out bytes.Buffer
+	p := &TerminalPrompter{
+		In:  strings.NewReader("maybe\nn\n\nsecret\n\n5\n1, 3\n"),
+		Out: &out,
+	}
+
+	// Invalid answers are asked again; prefixes choose buttons
+	if button, err := p.Ask("Continue?", []string{"Yes", "No"}, "Yes"); err != nil || button != "No" {
+		t.Errorf("got (%q, %v), want No", button, err)
+	}
+	if !strings.Contains(out.String(), "Continue? ([Yes]/No) ") {
+		t.Errorf("unexpected prompt %q", out.String())
+	}
+
+	// An empty answer chooses the default
+	if button, _ := p.Ask("Continue?", []string{"Yes", "No"}, "Yes"); button != "Yes" {
+		t.Errorf("got %q, want Yes", button)
+	}
+
+	if value, err := p.Input("Password", "", true); err != nil || value != "secret" {
+		t.Errorf("got (%q, %v)", value, err)
+	}
+	if value, _ := p.Input("Name", "Bob", false); value != "Bob" {
+		t.Errorf("got %q, want the default", value)
+	}
+
+	chosen, err := p.Choose("Pick", []string{"a", "b", "c"}, true)
+	if want := []string{"a", "c"}; err != nil || !reflect.DeepEqual(chosen, want) {
+		t.Errorf("got (%q, %v), want %q", chosen, err, want)
+	}
+
+	// The end of the input cancels
+	if _, err := p.Input("More", "", false); err != ErrCanceled {
+		t.Errorf("got %v, want ErrCanceled", err)
+	}
+}
+
+func TestScriptedPrompter(t *testing.T) {
+	w := testWorkflow()
+	p := &ScriptedPrompter{Answers: []PromptAnswer{
+		{Button: "Yes"},
+		{Value: "token"},
+		{Canceled: true},
+		{Chosen: []string{"b"}},
+	}}
+	w.Prompter = p
+
+	if ok, err := w.GetConfirmation("Delete it?", false); !ok || err != nil {
+		t.Errorf("confirmation: got (%v, %v)", ok, err)
+	}
+	if button, value, err := w.GetInput("API token", "", true); button != "Ok" || value != "token" || err != nil {
+		t.Errorf("input: got (%q, %q, %v)", button, value, err)
+	}
+	if button, _, err := w.GetInput("Name", "", false); button != "Cancel" || err != nil {
+		t.Errorf("canceled input: got (%q, %v)", button, err)
+	}
+	if chosen, err := w.GetChoice("Pick one", []string{"a", "b"}, false); !reflect.DeepEqual(chosen, []string{"b"}) || err != nil {
+		t.Errorf("choice: got (%q, %v)", chosen, err)
+	}
+	w.ShowMessage("Done")
+
+	want := []string{"Delete it?", "API token", "Name", "Pick one", "Done"}
+	if !reflect.DeepEqual(p.Prompts, want) {
+		t.Errorf("got prompts %q, want %q", p.Prompts, want)
+	}
+
+	if _, err := w.GetConfirmation("Again?", false); err == nil {
+		t.Error("expected an error when out of answers")
+	}
+}
+
+func TestAppleScriptPrompter(t *testing.T) {
+	runner := &RecordingScriptRunner{Results: []ScriptResult{
+		{Output: "ok\nNo"},
+		{Output: "ok\nsay \"hi\""},
+		{Output: "cancel"},
+		{Output: "ok\na\nc"},
+	}}
+	p := &AppleScriptPrompter{Title: "Test", App: "Alfred 5", Runner: runner}
+
+	if button, err := p.Ask(`Delete "it"?`, []string{"Yes", "No"}, ""); button != "No" || err != nil {
+		t.Errorf("got (%q, %v)", button, err)
+	}
+	if value, err := p.Input("Say", "", false); value != `say "hi"` || err != nil {
+		t.Errorf("got (%q, %v)", value, err)
+	}
+	if _, err := p.Input("Password", "", true); err != ErrCanceled {
+		t.Errorf("got %v, want ErrCanceled", err)
+	}
+	if chosen, err := p.Choose("Pick", []string{"a", "b", "c"}, true); !reflect.DeepEqual(chosen, []string{"a", "c"}) || err != nil {
+		t.Errorf("got (%q, %v)", chosen, err)
+	}
+
+	// Values are passed as arguments rather than in the source
+	want := [][]string{
+		{"Alfred 5", "Test", `Delete "it"?`, "No", "Yes", "No"},
+		{"Alfred 5", "Test", "Say:", "", "false"},
+		{"Alfred 5", "Test", "Password:", "", "true"},
+		{"Alfred 5", "Test", "Pick", "true", "a", "b", "c"},
+	}
+	for i, script := range runner.Scripts {
+		if !reflect.DeepEqual(script.Args, want[i]) {
+			t.Errorf("script %d: got args %q, want %q", i, script.Args, want[i])
+		}
+		if strings.Contains(script.Source, "Delete") || strings.Contains(script.Source, "Pick") {
+			t.Errorf("script %d: value interpolated into source", i)
+		}
+	}
+
+	if _, err := p.Choose("Pick", nil, false); err == nil {
+		t.Error("expected an error for no options")
+	}
+}
+
+func TestParsePromptResult(t *testing.T) {
+	if answer, err := parsePromptResult("ok\nline 1\nline 2"); err != nil || answer != "line 1\nline 2" {
+		t.Errorf("got (%q, %v)", answer, err)
+	}
+	if answer, err := parsePromptResult("ok"); err != nil || answer != "" {
+		t.Errorf("got (%q, %v)", answer, err)
+	}
+	if _, err := parsePromptResult("cancel"); err != ErrCanceled {
+		t.Errorf("got %v, want ErrCanceled", err)
+	}
+	if _, err := parsePromptResult("garbage"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestTerminalPrompterInputPrompt(t *testing.T) {
+	var out bytes.Buffer
+	w := testWorkflow()
+	w.Prompter = &TerminalPrompter{In: strings.NewReader("Bob\n"), Out: &out}
+
+	if _, value, _ := w.GetInput("Name", "", false); value != "Bob" {
+		t.Errorf("got %q, want Bob", value)
+	}
+	if got := out.String(); got != "Name: " {
+		t.Errorf("got prompt %q, want %q", got, "Name: ")
+	}
+}
@@ -0,0 +1,156 @@
+package alfred
+
+import (
+	"sync"
+	"time"
+)
+
+// Rerun and cache limits imposed by Alfred
+const (
+	MinRerun = 100 * time.Millisecond
+	MaxRerun = 5 * time.Second
+
+	MinCacheAge = 5 * time.Second
+	MaxCacheAge = 24 * time.Hour
+)
+
+// ResultCache describes how Alfred should cache a Script Filter's results.
+// While results are cached, Alfred shows them without running the workflow.
+type ResultCache struct {
+	// MaxAge is how long results are cached. It's clamped to the range
+	// Alfred supports (MinCacheAge to MaxCacheAge).
+	MaxAge time.Duration
+	// LooseReload makes Alfred show stale results immediately while it runs
+	// the workflow in the background to refresh them.
+	LooseReload bool
+}
+
+// Response is a complete Script Filter response
+type Response struct {
+	Items Items
+	// Rerun is the interval after which Alfred should run the Script Filter
+	// again. Zero means don't rerun.
+	Rerun time.Duration
+	// Cache is the cache directive for the response, if any
+	Cache *ResultCache
+	// Variables are workflow variables passed to downstream objects
+	Variables map[string]string
+}
+
+// Rerun asks Alfred to run the Script Filter again after the given interval,
+// which is clamped to the range Alfred supports (MinRerun to MaxRerun). A
+// Filter can use this to show cached or partial results (and a LoadingItem)
+// while data is fetched in the background; Alfred will keep re-invoking the
+// workflow for as long as Rerun is called.
+//
+// Rerun only has an effect while the workflow is running.
+func (w *Workflow) Rerun(interval time.Duration) {
+	if interval < MinRerun {
+		interval = MinRerun
+	} else if interval > MaxRerun {
+		interval = MaxRerun
+	}
+
+	if s := w.state; s != nil {
+		s.Lock()
+		s.rerun = interval
+		s.Unlock()
+	}
+}
+
+// SetCache sets how Alfred should cache the current Script Filter response.
+// It overrides the cache settings of the Workflow and the running command.
+// Responses for errors are never cached.
+//
+// SetCache only has an effect while the workflow is running.
+func (w *Workflow) SetCache(cache ResultCache) {
+	if s := w.state; s != nil {
+		s.Lock()
+		s.cache = &cache
+		s.Unlock()
+	}
+}
+
+// SetVariable sets a workflow variable. In tell mode, variables are included
+// in the Script Filter response and are available to downstream workflow
+// objects whichever item is actioned. In do mode, they're output with the
+// Action's result in an alfredworkflow object.
+//
+// SetVariable only has an effect while the workflow is running.
+func (w *Workflow) SetVariable(name, value string) {
+	if s := w.state; s != nil {
+		s.Lock()
+		if s.variables == nil {
+			s.variables = map[string]string{}
+		}
+		s.variables[name] = value
+		s.Unlock()
+	}
+}
+
+// LoadingItem returns a non-actionable item indicating that results are still
+// being loaded
+func LoadingItem(subtitle string) Item {
+	return Item{
+		Title:    "Loading…",
+		Subtitle: subtitle,
+	}
+}
+
+// support -------------------------------------------------------------------
+
+// runState holds response values that commands may set while a workflow is
+// running. Commands may run concurrently, so access must be locked.
+type runState struct {
+	sync.Mutex
+	rerun     time.Duration
+	variables map[string]string
+	cache     *ResultCache
+	stack     []navFrame
+	title     string
+	// args are the arguments the workflow was run with
+	args []string
+}
+
+// response creates a Script Filter response for a list of items
+func (w *Workflow) response(items Items) (r *Response) {
+	r = &Response{Items: items}
+
+	if s := w.state; s != nil {
+		s.Lock()
+		defer s.Unlock()
+		r.Rerun = s.rerun
+		r.Variables = s.variables
+
+		if c := s.cache; c != nil && c.MaxAge > 0 {
+			cache := *c
+			if cache.MaxAge < MinCacheAge {
+				cache.MaxAge = MinCacheAge
+			} else if cache.MaxAge > MaxCacheAge {
+				cache.MaxAge = MaxCacheAge
+			}
+			r.Cache = &cache
+		}
+	}
+
+	return
+}
+
+// disableCache prevents Alfred from caching the current response
+func (w *Workflow) disableCache() {
+	if s := w.state; s != nil {
+		s.Lock()
+		s.cache = nil
+		s.Unlock()
+	}
+}
+
+// variables returns the workflow variables set during the current run
+func (w *Workflow) variables() map[string]string {
+	if s := w.state; s != nil {
+		s.Lock()
+		defer s.Unlock()
+		return s.variables
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package alfred
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScriptLanguage is a language osascript can run
+type ScriptLanguage string
+
+// Script languages
+const (
+	AppleScript ScriptLanguage = "AppleScript"
+	JavaScript  ScriptLanguage = "JavaScript"
+)
+
+// Script is a script to be run by a ScriptRunner
+type Script struct {
+	// Language is the script's language (default: AppleScript)
+	Language ScriptLanguage
+	// Source is the script's source code
+	Source string
+	// Args are passed to the script's run handler (AppleScript's "on run
+	// argv" or JavaScript's "function run(argv)"). Passing values as
+	// arguments avoids having to escape them in the source.
+	Args []string
+	// Timeout is how long the script may run. A zero Timeout means no limit.
+	Timeout time.Duration
+}
+
+// ScriptRunner runs AppleScript and JavaScript for Automation scripts. It
+// returns the script's result as text.
+type ScriptRunner interface {
+	RunScript(script Script) (string, error)
+}
+
+// OsascriptRunner runs scripts with macOS's osascript
+type OsascriptRunner struct{}
+
+// RunScript runs a script with osascript. The source is read from stdin so
+// that the arguments can be passed on the command line.
+func (r *OsascriptRunner) RunScript(script Script) (out string, err error) {
+	ctx := context.Background()
+	if script.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, script.Timeout)
+		defer cancel()
+	}
+
+	language := script.Language
+	if language == "" {
+		language = AppleScript
+	}
+
+	args := append([]string{"-l", string(language), "-"}, script.Args...)
+	cmd := exec.CommandContext(ctx, "osascript", args...)
+	cmd.Stdin = strings.NewReader(script.Source)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	var raw []byte
+	raw, err = cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("script took longer than %v", script.Timeout)
+	} else if err != nil {
+		dlog.Printf("Error running script: %v: %s", err, stderr.String())
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("script failed: %s", msg)
+		}
+		return
+	}
+
+	return strings.TrimSuffix(string(raw), "\n"), nil
+}
+
+// RecordingScriptRunner records the scripts it's asked to run instead of
+// running them. It's meant for tests.
+type RecordingScriptRunner struct {
+	// Results are returned, in order, for the scripts that are run. When
+	// there are no more results, an empty string is returned.
+	Results []ScriptResult
+	// Scripts records the scripts that were run
+	Scripts []Script
+
+	mutex sync.Mutex
+}
+
+// ScriptResult is a scripted result for a RecordingScriptRunner
+type ScriptResult struct {
+	Output string
+	Err    error
+}
+
+// RunScript records a script and returns the next result
+func (r *RecordingScriptRunner) RunScript(script Script) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Scripts = append(r.Scripts, script)
+
+	if len(r.Results) == 0 {
+		return "", nil
+	}
+
+	var result ScriptResult
+	result, r.Results = r.Results[0], r.Results[1:]
+	return result.Output, result.Err
+}
+
+// RunScript runs a script with the workflow's ScriptRunner
+func (w *Workflow) RunScript(script Script) (string, error) {
+	return w.scriptRunner().RunScript(script)
+}
+
+// RunScriptJSON runs a JavaScript for Automation script and decodes its
+// result into v. The script's source is the body of a function that's called
+// with the script's args as argv, and returns a value that can be converted
+// to JSON. If the function doesn't return anything, v is left as is.
+func (w *Workflow) RunScriptJSON(script Script, v interface{}) (err error) {
+	if script.Language != "" && script.Language != JavaScript {
+		return fmt.Errorf("JSON results require JavaScript, not %s", script.Language)
+	}
+
+	script.Language = JavaScript
+	script.Source = fmt.Sprintf(jsonScript, script.Source)
+
+	var out string
+	if out, err = w.RunScript(script); err != nil || out == "" {
+		return
+	}
+
+	return json.Unmarshal([]byte(out), v)
+}
+
+// ShowNotification shows a macOS notification with the workflow's name as
+// its title
+func (w *Workflow) ShowNotification(message string) (err error) {
+	_, err = w.RunScript(Script{
+		Source:  notificationScript,
+		Args:    []string{w.name, message},
+		Timeout: notificationTimeout,
+	})
+	return
+}
+
+// support -------------------------------------------------------------------
+
+// notificationTimeout is how long showing a notification may take
+const notificationTimeout = 10 * time.Second
+
+// jsonScript wraps the body of a JavaScript function so that its result is
+// written as JSON
+const jsonScript = `function run(argv) {
+	var result = (function (argv) {
+%s
+	})(argv);
+	return result === undefined ? "" : JSON.stringify(result);
+}`
+
+// notificationScript shows a notification; its args are the title and the
+// message
+const notificationScript = `on run argv
+	display notification (item 2 of argv) with title (item 1 of argv)
+end run`
+
+// scriptRunner returns the workflow's ScriptRunner
+func (w *Workflow) scriptRunner() ScriptRunner {
+	if w.ScriptRunner != nil {
+		return w.ScriptRunner
+	}
+	return &OsascriptRunner{}
+}
@@ -0,0 +1,76 @@
+package alfred
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunScriptJSON(t *testing.T) {
+	w := testWorkflow()
+	runner := &RecordingScriptRunner{Results: []ScriptResult{
+		{Output: `{"name":"Finder","windows":2}`},
+		{Output: ""},
+		{Err: errors.New("script failed")},
+	}}
+	w.ScriptRunner = runner
+
+	var result struct {
+		Name    string `json:"name"`
+		Windows int    `json:"windows"`
+	}
+	script := Script{Source: `return {name: argv[0], windows: 2}`, Args: []string{"Finder"}}
+	if err := w.RunScriptJSON(script, &result); err != nil || result.Name != "Finder" || result.Windows != 2 {
+		t.Errorf("got (%+v, %v)", result, err)
+	}
+
+	ran := runner.Scripts[0]
+	if ran.Language != JavaScript || !reflect.DeepEqual(ran.Args, []string{"Finder"}) {
+		t.Errorf("got script %+v", ran)
+	}
+	if !strings.Contains(ran.Source, "function run(argv)") || !strings.Contains(ran.Source, script.Source) {
+		t.Errorf("source wasn't wrapped: %s", ran.Source)
+	}
+
+	// A script without a result leaves v as is
+	if err := w.RunScriptJSON(script, &result); err != nil || result.Name != "Finder" {
+		t.Errorf("got (%+v, %v)", result, err)
+	}
+
+	if err := w.RunScriptJSON(script, &result); err == nil {
+		t.Error("expected the script's error")
+	}
+
+	if err := w.RunScriptJSON(Script{Language: AppleScript}, &result); err == nil {
+		t.Error("expected an error for AppleScript")
+	}
+}
+
+func TestShowNotification(t *testing.T) {
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_workflow_name": "Test"}, false)
+	runner := &RecordingScriptRunner{}
+	w.ScriptRunner = runner
+
+	w.ShowNotification(`Copied "it"`)
+
+	if len(runner.Scripts) != 1 {
+		t.Fatalf("got %d scripts, want 1", len(runner.Scripts))
+	}
+	if got, want := runner.Scripts[0].Args, []string{"Test", `Copied "it"`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got args %q, want %q", got, want)
+	}
+}
+
+func TestDialogsUseScriptRunner(t *testing.T) {
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_workflow_name": "Test", "alfred_short_version": "5"}, false)
+	runner := &RecordingScriptRunner{Results: []ScriptResult{{Output: "ok\nYes"}}}
+	w.ScriptRunner = runner
+
+	if ok, err := w.GetConfirmation("Sure?", true); !ok || err != nil {
+		t.Errorf("got (%v, %v)", ok, err)
+	}
+	if got, want := runner.Scripts[0].Args, []string{"Alfred 5", "Test", "Sure?", "Yes", "Yes", "No"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got args %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,457 @@
+package alfred
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// SecretStore stores secrets such as passwords and API tokens. Get returns
+// ErrNotFound for a key that hasn't been set. Deleting a key that hasn't been
+// set isn't an error.
+type SecretStore interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) error
+	List() ([]string, error)
+}
+
+// Secrets returns the workflow's SecretStore. If the workflow's SecretStore
+// field is nil, the macOS Keychain is used on macOS, and a FileSecretStore in
+// DataDir() is used elsewhere. Keys are namespaced by BundleID().
+//
+// The FileSecretStore's passphrase is read from the alfred_secret_passphrase
+// environment variable, which can be set as a workflow variable in Alfred or
+// as a secret in CI. Without it, the encryption key is kept in a file next to
+// the secrets, so the secrets are only as safe as the data directory.
+func (w *Workflow) Secrets() SecretStore {
+	if w.SecretStore != nil {
+		return w.SecretStore
+	}
+
+	if runtime.GOOS == "darwin" {
+		return &KeychainSecretStore{Account: w.bundleID}
+	}
+
+	return &FileSecretStore{
+		Filename:   path.Join(w.dataDir, "secrets.json"),
+		Namespace:  w.bundleID,
+		Passphrase: w.env["alfred_secret_passphrase"],
+	}
+}
+
+// KeychainSecretStore stores secrets as generic passwords in the macOS
+// Keychain. Each secret is stored with the key as the service name.
+type KeychainSecretStore struct {
+	// Account is the account name of the stored passwords, which namespaces
+	// the keys
+	Account string
+}
+
+// Get returns a secret from the Keychain
+func (k *KeychainSecretStore) Get(key string) (value string, err error) {
+	var out []byte
+	out, err = k.security("find-generic-password", "-a", k.Account, "-s", key, "-w")
+	if err != nil {
+		return
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// Set adds or updates a secret in the Keychain
+func (k *KeychainSecretStore) Set(key, value string) (err error) {
+	_, err = k.security("add-generic-password", "-U", "-a", k.Account, "-s", key, "-w", value)
+	return
+}
+
+// Delete removes a secret from the Keychain
+func (k *KeychainSecretStore) Delete(key string) (err error) {
+	if _, err = k.security("delete-generic-password", "-a", k.Account, "-s", key); err == ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// List returns the keys of the secrets in the Keychain
+func (k *KeychainSecretStore) List() (keys []string, err error) {
+	var out []byte
+	if out, err = k.security("dump-keychain"); err != nil {
+		return
+	}
+	return keychainKeys(out, k.Account), nil
+}
+
+// FileSecretStore stores secrets in a file encrypted with AES-GCM. It's meant
+// for systems without a Keychain, such as CI servers. The encryption key is
+// derived from Passphrase with scrypt; if there's no passphrase, a random key
+// is generated and stored next to the file, which only protects the secrets if
+// the file is copied without the key.
+type FileSecretStore struct {
+	// Filename is the name of the encrypted file
+	Filename string
+	// Namespace separates the keys of different workflows that share a file
+	Namespace string
+	// Passphrase is used to derive the encryption key
+	Passphrase string
+
+	mutex sync.Mutex
+	key   []byte
+	kdf   secretKDF
+	salt  []byte
+}
+
+// Get returns a secret from the file
+func (f *FileSecretStore) Get(key string) (value string, err error) {
+	var secrets map[string]string
+	if secrets, err = f.read(false); err != nil {
+		return
+	}
+
+	var ok bool
+	if value, ok = secrets[key]; !ok {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Set adds or updates a secret in the file
+func (f *FileSecretStore) Set(key, value string) error {
+	return f.update(func(secrets map[string]string) {
+		secrets[key] = value
+	})
+}
+
+// Delete removes a secret from the file
+func (f *FileSecretStore) Delete(key string) error {
+	return f.update(func(secrets map[string]string) {
+		delete(secrets, key)
+	})
+}
+
+// List returns the keys of the secrets in the file
+func (f *FileSecretStore) List() (keys []string, err error) {
+	var secrets map[string]string
+	if secrets, err = f.read(false); err != nil {
+		return
+	}
+
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// MemorySecretStore stores secrets in memory. It's meant for tests.
+type MemorySecretStore struct {
+	mutex   sync.Mutex
+	secrets map[string]string
+}
+
+// Get returns a secret
+func (m *MemorySecretStore) Get(key string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if value, ok := m.secrets[key]; ok {
+		return value, nil
+	}
+	return "", ErrNotFound
+}
+
+// Set adds or updates a secret
+func (m *MemorySecretStore) Set(key, value string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.secrets == nil {
+		m.secrets = map[string]string{}
+	}
+	m.secrets[key] = value
+	return nil
+}
+
+// Delete removes a secret
+func (m *MemorySecretStore) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.secrets, key)
+	return nil
+}
+
+// List returns the keys of the stored secrets
+func (m *MemorySecretStore) List() (keys []string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key := range m.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// support -------------------------------------------------------------------
+
+// securityNotFound is the exit code of the security tool when an item
+// doesn't exist
+const securityNotFound = 44
+
+// security runs the macOS security tool
+func (k *KeychainSecretStore) security(args ...string) (out []byte, err error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", args...)
+	cmd.Stderr = &stderr
+
+	if out, err = cmd.Output(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == securityNotFound {
+			return nil, ErrNotFound
+		}
+		dlog.Printf("Error running security %s: %s", args[0], stderr.String())
+	}
+	return
+}
+
+// keychainAttr matches an account or service attribute in the output of
+// security dump-keychain
+var keychainAttr = regexp.MustCompile(`^\s+"(acct|svce)"<blob>="(.*)"$`)
+
+// keychainKeys returns the service names of the generic passwords with the
+// given account in the output of security dump-keychain
+func keychainKeys(dump []byte, account string) (keys []string) {
+	var class, acct, svce string
+
+	flush := func() {
+		if class == "genp" && acct == account && svce != "" {
+			keys = append(keys, svce)
+		}
+		class, acct, svce = "", "", ""
+	}
+
+	for _, line := range strings.Split(string(dump), "\n") {
+		if strings.HasPrefix(line, "keychain: ") {
+			flush()
+		} else if strings.HasPrefix(line, "class: ") {
+			class = strings.Trim(strings.TrimPrefix(line, "class: "), `"`)
+		} else if m := keychainAttr.FindStringSubmatch(line); m != nil {
+			if m[1] == "acct" {
+				acct = m[2]
+			} else {
+				svce = m[2]
+			}
+		}
+	}
+	flush()
+
+	sort.Strings(keys)
+	return
+}
+
+// secretFile is the content of a FileSecretStore's file
+type secretFile struct {
+	KDF   secretKDF `json:"kdf"`
+	Salt  []byte    `json:"salt"`
+	Nonce []byte    `json:"nonce"`
+	Data  []byte    `json:"data"`
+}
+
+// secretKDF describes how a FileSecretStore's key is derived
+type secretKDF struct {
+	Name string `json:"name"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// defaultKDF are the scrypt parameters used for new files, as recommended by
+// the scrypt package for interactive logins
+var defaultKDF = secretKDF{Name: "scrypt", N: 1 << 15, R: 8, P: 1}
+
+// read decrypts the secrets in the store's namespace. The file must be locked
+// if it will be updated.
+func (f *FileSecretStore) read(locked bool) (secrets map[string]string, err error) {
+	if !locked {
+		var unlock func()
+		if unlock, err = f.lock(false); err != nil {
+			return
+		}
+		defer unlock()
+	}
+
+	var all map[string]map[string]string
+	if all, _, err = f.readAll(); err != nil {
+		return
+	}
+
+	if secrets = all[f.Namespace]; secrets == nil {
+		secrets = map[string]string{}
+	}
+	return
+}
+
+// update modifies the secrets in the store's namespace
+func (f *FileSecretStore) update(fn func(secrets map[string]string)) (err error) {
+	var unlock func()
+	if unlock, err = f.lock(true); err != nil {
+		return
+	}
+	defer unlock()
+
+	var all map[string]map[string]string
+	var file secretFile
+	if all, file, err = f.readAll(); err != nil {
+		return
+	}
+
+	if all[f.Namespace] == nil {
+		all[f.Namespace] = map[string]string{}
+	}
+	fn(all[f.Namespace])
+
+	return f.writeAll(all, file)
+}
+
+// lock takes an advisory lock on the store's file
+func (f *FileSecretStore) lock(exclusive bool) (unlock func(), err error) {
+	if f.Filename == "" {
+		return nil, errNoStore
+	}
+	if err = os.MkdirAll(path.Dir(f.Filename), 0755); err != nil {
+		return
+	}
+	return lockFile(f.Filename+".lock", exclusive)
+}
+
+// readAll decrypts all the secrets in the file, and returns the file so its
+// key derivation can be reused when it's written
+func (f *FileSecretStore) readAll() (all map[string]map[string]string, file secretFile, err error) {
+	all = map[string]map[string]string{}
+
+	var data []byte
+	if data, err = os.ReadFile(f.Filename); os.IsNotExist(err) {
+		return all, file, nil
+	} else if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(data, &file); err != nil {
+		return
+	}
+
+	var gcm cipher.AEAD
+	if gcm, err = f.cipher(file.KDF, file.Salt); err != nil {
+		return
+	}
+
+	var plain []byte
+	if plain, err = gcm.Open(nil, file.Nonce, file.Data, nil); err != nil {
+		return nil, file, errors.New("unable to decrypt secrets; the passphrase may be wrong")
+	}
+
+	err = json.Unmarshal(plain, &all)
+	return
+}
+
+// writeAll encrypts secrets and writes them to the file. The key derivation
+// of the existing file is kept, so the key doesn't need to be derived again.
+func (f *FileSecretStore) writeAll(all map[string]map[string]string, file secretFile) (err error) {
+	var plain []byte
+	if plain, err = json.Marshal(all); err != nil {
+		return
+	}
+
+	if file.Salt == nil {
+		file.KDF = defaultKDF
+		file.Salt = make([]byte, 16)
+		if _, err = rand.Read(file.Salt); err != nil {
+			return
+		}
+	}
+
+	var gcm cipher.AEAD
+	if gcm, err = f.cipher(file.KDF, file.Salt); err != nil {
+		return
+	}
+
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(file.Nonce); err != nil {
+		return
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+
+	var data []byte
+	if data, err = json.Marshal(&file); err != nil {
+		return
+	}
+
+	return writeFileAtomic(f.Filename, data, 0600)
+}
+
+// cipher returns an AES-GCM cipher using a key derived from the store's
+// passphrase (or key file). The last key is remembered, since deriving one is
+// deliberately slow.
+func (f *FileSecretStore) cipher(kdf secretKDF, salt []byte) (gcm cipher.AEAD, err error) {
+	if kdf.Name != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation '%s'", kdf.Name)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.key == nil || f.kdf != kdf || !bytes.Equal(f.salt, salt) {
+		secret := []byte(f.Passphrase)
+		if len(secret) == 0 {
+			if secret, err = f.keyFile(); err != nil {
+				return
+			}
+		}
+
+		var key []byte
+		if key, err = scrypt.Key(secret, salt, kdf.N, kdf.R, kdf.P, 32); err != nil {
+			return
+		}
+		f.key, f.kdf, f.salt = key, kdf, salt
+	}
+
+	var block cipher.Block
+	if block, err = aes.NewCipher(f.key); err != nil {
+		return
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyFile returns the random key stored next to the file, creating it if
+// necessary
+func (f *FileSecretStore) keyFile() (key []byte, err error) {
+	filename := f.Filename + ".key"
+
+	if key, err = os.ReadFile(filename); err == nil {
+		return
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	key = make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		return
+	}
+
+	err = writeFileAtomic(filename, key, 0600)
+	return
+}
@@ -0,0 +1,134 @@
+package alfred
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecretStores(t *testing.T) {
+	dir := t.TempDir()
+	stores := map[string]SecretStore{
+		"memory":     &MemorySecretStore{},
+		"file":       &FileSecretStore{Filename: path.Join(dir, "secrets.json"), Namespace: "com.example"},
+		"passphrase": &FileSecretStore{Filename: path.Join(dir, "other.json"), Passphrase: "hunter2"},
+	}
+
+	for name, store := range stores {
+		if _, err := store.Get("token"); err != ErrNotFound {
+			t.Errorf("%s: got %v, want ErrNotFound", name, err)
+		}
+
+		store.Set("token", "abc")
+		store.Set("password", "xyz")
+		store.Set("token", "def")
+
+		if v, err := store.Get("token"); err != nil || v != "def" {
+			t.Errorf("%s: got (%q, %v)", name, v, err)
+		}
+
+		keys, _ := store.List()
+		if want := []string{"password", "token"}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("%s: got keys %q, want %q", name, keys, want)
+		}
+
+		if err := store.Delete("token"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if err := store.Delete("token"); err != nil {
+			t.Errorf("%s: deleting a missing key: %v", name, err)
+		}
+		if _, err := store.Get("token"); err != ErrNotFound {
+			t.Errorf("%s: got %v after delete, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestFileSecretStore(t *testing.T) {
+	filename := path.Join(t.TempDir(), "secrets.json")
+	store := &FileSecretStore{Filename: filename, Namespace: "com.example.a", Passphrase: "hunter2"}
+	store.Set("token", "very secret")
+
+	// Secrets are encrypted
+	data, _ := os.ReadFile(filename)
+	if strings.Contains(string(data), "very secret") || strings.Contains(string(data), "token") {
+		t.Errorf("secrets are stored in the clear: %s", data)
+	}
+
+	// The key derivation is recorded with the secrets
+	var file secretFile
+	json.Unmarshal(data, &file)
+	if file.KDF != defaultKDF || len(file.Salt) != 16 {
+		t.Errorf("got key derivation %+v with a %d-byte salt", file.KDF, len(file.Salt))
+	}
+	if defaultKDF.Name != "scrypt" || defaultKDF.N < 1<<15 {
+		t.Errorf("weak key derivation %+v", defaultKDF)
+	}
+
+	// Namespaces are separate
+	other := &FileSecretStore{Filename: filename, Namespace: "com.example.b", Passphrase: "hunter2"}
+	if _, err := other.Get("token"); err != ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+	other.Set("token", "other")
+	if v, _ := store.Get("token"); v != "very secret" {
+		t.Errorf("got %q after setting another namespace", v)
+	}
+
+	// The passphrase must match
+	wrong := &FileSecretStore{Filename: filename, Namespace: "com.example.a", Passphrase: "wrong"}
+	if _, err := wrong.Get("token"); err == nil || err == ErrNotFound {
+		t.Errorf("got %v for a wrong passphrase", err)
+	}
+}
+
+func TestWorkflowSecrets(t *testing.T) {
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_workflow_data": t.TempDir()}, false)
+	w.SecretStore = &MemorySecretStore{}
+
+	if err := w.AddPassword("api", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if pw, err := w.GetPassword("api"); err != nil || pw != "abc" {
+		t.Errorf("got (%q, %v)", pw, err)
+	}
+	w.DeletePassword("api")
+	if _, err := w.GetPassword("api"); err != ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestKeychainKeys(t *testing.T) {
+	dump := `keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    "acct"<blob>="com.example.wf"
+    "svce"<blob>="token"
+keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    "acct"<blob>="someone.else"
+    "svce"<blob>="other"
+keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "inet"
+attributes:
+    "acct"<blob>="com.example.wf"
+    "svce"<blob>="web"
+keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    "acct"<blob>="com.example.wf"
+    "svce"<blob>="password"
+`
+	keys := keychainKeys([]byte(dump), "com.example.wf")
+	if want := []string{"password", "token"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %q, want %q", keys, want)
+	}
+}
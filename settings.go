@@ -0,0 +1,387 @@
+package alfred
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Settings is a Command that lets the user view and edit a workflow's
+// settings. The settings are the exported fields of a struct, which are
+// described with struct tags:
+//
+//	label:"Theme"              the name shown for the setting (default: the field name)
+//	description:"..."          shown as the setting's subtitle
+//	type:"enum"                bool, int, string, or enum (default: from the field's type)
+//	options:"light,dark"       the choices for an enum
+//	secret:"true"              the value is never displayed, and is kept in the SecretStore
+//
+// Fields with the tag label:"-" and fields of other types are ignored.
+//
+// As a Filter, Settings lists each setting with its current value. Selecting a
+// bool toggles it, and selecting an enum, int, or string setting opens a view
+// where a new value can be chosen or typed. As an Action, Settings applies an
+// edit and saves the settings in their own namespace of the workflow's Store.
+type Settings struct {
+	// Keyword is the command's keyword
+	Keyword string
+	// Description is the command's description
+	Description string
+
+	w      *Workflow
+	value  reflect.Value
+	fields []settingField
+}
+
+// NewSettings loads saved settings into v, which must be a pointer to a
+// struct, and returns a Settings command that edits them. If no settings
+// have been saved, v is left as is, so it can be initialized with defaults.
+func (w *Workflow) NewSettings(keyword string, v interface{}) (s *Settings, err error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("settings must be a pointer to a struct, not %T", v)
+	}
+
+	s = &Settings{
+		Keyword:     keyword,
+		Description: "View and edit settings",
+		w:           w,
+		value:       value,
+	}
+
+	if s.fields, err = settingFields(value.Elem().Type()); err != nil {
+		return nil, err
+	}
+
+	if err = settingsStore(w).Get(settingsKey, v); err != nil && err != ErrNotFound {
+		return nil, err
+	}
+
+	if err = s.loadSecrets(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// Save saves the current settings. Secret settings are saved in the
+// workflow's SecretStore rather than with the other settings.
+func (s *Settings) Save() (err error) {
+	public := reflect.New(s.value.Elem().Type())
+	public.Elem().Set(s.value.Elem())
+
+	for _, f := range s.fields {
+		if !f.secret {
+			continue
+		}
+
+		field := public.Elem().FieldByIndex(f.index)
+		if value := field.String(); value == "" {
+			err = s.w.Secrets().Delete(f.secretKey())
+		} else {
+			err = s.w.Secrets().Set(f.secretKey(), value)
+		}
+		if err != nil {
+			return
+		}
+		field.SetString("")
+	}
+
+	return settingsStore(s.w).Set(settingsKey, public.Interface())
+}
+
+// About returns a CommandDef for the settings command
+func (s *Settings) About() CommandDef {
+	return CommandDef{
+		Keyword:     s.Keyword,
+		Description: s.Description,
+		IsEnabled:   true,
+	}
+}
+
+// Items returns the settings, or the choices for one setting if data names
+// it
+func (s *Settings) Items(arg, data string) (items []Item, err error) {
+	if data == "" {
+		for _, f := range s.fields {
+			items = append(items, s.settingItem(f))
+		}
+		FuzzySort(items, arg)
+		return
+	}
+
+	f, ok := s.field(data)
+	if !ok {
+		return nil, fmt.Errorf("unknown setting '%s'", data)
+	}
+
+	if f.kind == "enum" {
+		current := s.value.Elem().FieldByIndex(f.index).String()
+		for _, option := range f.options {
+			item := Item{
+				Title: option,
+				Arg:   NewArg(s.Keyword, ModeDo, settingEdit{Field: f.name, Value: option}),
+			}
+			item.AddCheckBox(option == current)
+			items = append(items, item)
+		}
+		FuzzySort(items, arg)
+		return
+	}
+
+	item := Item{
+		Title:    fmt.Sprintf("Set %s to '%s'", f.label, f.display(arg)),
+		Subtitle: fmt.Sprintf("Currently %s", f.display(s.current(f))),
+	}
+
+	if arg == "" {
+		item.Title = fmt.Sprintf("Type a new value for %s", f.label)
+	} else if _, err := f.parse(arg); err != nil {
+		item.Subtitle = err.Error()
+	} else {
+		item.Arg = NewArg(s.Keyword, ModeDo, settingEdit{Field: f.name, Value: arg})
+	}
+
+	return []Item{item}, nil
+}
+
+// Do applies an edit to a setting and saves the settings
+func (s *Settings) Do(data string) (out string, err error) {
+	var edit settingEdit
+	if edit, err = DecodeData[settingEdit](data); err != nil {
+		return
+	}
+
+	f, ok := s.field(edit.Field)
+	if !ok {
+		return "", fmt.Errorf("unknown setting '%s'", edit.Field)
+	}
+
+	var value reflect.Value
+	if value, err = f.parse(edit.Value); err != nil {
+		return
+	}
+
+	s.value.Elem().FieldByIndex(f.index).Set(value)
+	if err = s.Save(); err != nil {
+		return
+	}
+
+	return fmt.Sprintf("%s set to %s", f.label, f.display(edit.Value)), nil
+}
+
+// support -------------------------------------------------------------------
+
+// settingsNamespace is the Store namespace the settings are saved in, so
+// they don't conflict with the workflow's own keys. It's also the prefix of
+// secret settings' SecretStore keys.
+const settingsNamespace = "settings"
+
+// settingsKey is the key the settings are saved under
+const settingsKey = "values"
+
+// settingsStore returns the Store the settings are saved in
+func settingsStore(w *Workflow) *Store {
+	return w.Store().Namespace(settingsNamespace)
+}
+
+// settingKinds are the field types each kind of setting can have
+var settingKinds = map[string]map[reflect.Kind]bool{
+	"bool": {reflect.Bool: true},
+	"int": {
+		reflect.Int: true, reflect.Int8: true, reflect.Int16: true,
+		reflect.Int32: true, reflect.Int64: true,
+	},
+	"string": {reflect.String: true},
+	"enum":   {reflect.String: true},
+}
+
+// settingField describes a setting
+type settingField struct {
+	index       []int
+	name        string
+	label       string
+	description string
+	kind        string
+	options     []string
+	secret      bool
+	typ         reflect.Type
+}
+
+// settingEdit is a change to a setting
+type settingEdit struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// settingFields returns the settings described by a struct type
+func settingFields(t reflect.Type) (fields []settingField, err error) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" || sf.Tag.Get("label") == "-" {
+			continue
+		}
+
+		f := settingField{
+			index:       sf.Index,
+			name:        sf.Name,
+			label:       sf.Tag.Get("label"),
+			description: sf.Tag.Get("description"),
+			kind:        sf.Tag.Get("type"),
+			secret:      sf.Tag.Get("secret") == "true",
+			typ:         sf.Type,
+		}
+
+		if f.label == "" {
+			f.label = sf.Name
+		}
+
+		if options := sf.Tag.Get("options"); options != "" {
+			f.options = CleanSplitN(options, ",", -1)
+			if f.kind == "" {
+				f.kind = "enum"
+			}
+		}
+
+		if f.kind == "" {
+			switch sf.Type.Kind() {
+			case reflect.Bool:
+				f.kind = "bool"
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				f.kind = "int"
+			case reflect.String:
+				f.kind = "string"
+			default:
+				continue
+			}
+		}
+
+		if f.kind == "enum" && len(f.options) == 0 {
+			return nil, fmt.Errorf("enum setting %s has no options", sf.Name)
+		}
+
+		if !settingKinds[f.kind][sf.Type.Kind()] {
+			return nil, fmt.Errorf("setting %s can't be a %s", sf.Name, f.kind)
+		}
+
+		if f.secret && f.kind != "string" {
+			return nil, fmt.Errorf("secret setting %s must be a string", sf.Name)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return
+}
+
+// field returns the setting with a given field name
+func (s *Settings) field(name string) (f settingField, ok bool) {
+	for _, f := range s.fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return
+}
+
+// loadSecrets reads secret settings from the workflow's SecretStore
+func (s *Settings) loadSecrets() error {
+	for _, f := range s.fields {
+		if !f.secret {
+			continue
+		}
+
+		value, err := s.w.Secrets().Get(f.secretKey())
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		s.value.Elem().FieldByIndex(f.index).SetString(value)
+	}
+	return nil
+}
+
+// secretKey returns the SecretStore key of a secret setting
+func (f settingField) secretKey() string {
+	return settingsNamespace + "." + f.name
+}
+
+// current returns the current value of a setting as a string
+func (s *Settings) current(f settingField) string {
+	return fmt.Sprint(s.value.Elem().FieldByIndex(f.index).Interface())
+}
+
+// settingItem returns an item for a setting in the settings list
+func (s *Settings) settingItem(f settingField) (item Item) {
+	current := s.current(f)
+
+	item.Title = fmt.Sprintf("%s: %s", f.label, f.display(current))
+	item.Subtitle = f.description
+
+	if f.kind == "bool" {
+		value := s.value.Elem().FieldByIndex(f.index).Bool()
+		item.Title = f.label
+		item.AddCheckBox(value)
+		item.Arg = NewArg(s.Keyword, ModeDo, settingEdit{
+			Field: f.name,
+			Value: strconv.FormatBool(!value),
+		})
+		return
+	}
+
+	item.Arg = &ItemArg{
+		Keyword: s.Keyword,
+		Data:    f.name,
+		Push:    true,
+		Title:   f.label,
+	}
+	return
+}
+
+// parse converts a string to a value for a setting
+func (f settingField) parse(s string) (v reflect.Value, err error) {
+	v = reflect.New(f.typ).Elem()
+
+	switch f.kind {
+	case "bool":
+		var b bool
+		if b, err = strconv.ParseBool(s); err != nil {
+			return v, fmt.Errorf("%s must be true or false", f.label)
+		}
+		v.SetBool(b)
+	case "int":
+		var i int64
+		if i, err = strconv.ParseInt(strings.TrimSpace(s), 10, f.typ.Bits()); err != nil {
+			return v, fmt.Errorf("%s must be a whole number", f.label)
+		}
+		v.SetInt(i)
+	case "enum":
+		for _, option := range f.options {
+			if s == option {
+				v.SetString(s)
+				return
+			}
+		}
+		return v, fmt.Errorf("%s must be one of %s", f.label, strings.Join(f.options, ", "))
+	default:
+		v.SetString(s)
+	}
+
+	return
+}
+
+// display returns a value as it should be shown to the user
+func (f settingField) display(value string) string {
+	if f.secret {
+		if value == "" {
+			return "not set"
+		}
+		return strings.Repeat("•", 8)
+	}
+	if value == "" && f.kind == "string" {
+		return "empty"
+	}
+	return value
+}
@@ -0,0 +1,128 @@
+package alfred
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testSettings struct {
+	Enabled bool   `label:"Enabled" description:"Turn it on"`
+	Theme   string `label:"Theme" options:"light, dark"`
+	Limit   int    `label:"Limit"`
+	Name    string
+	Token   string `label:"API token" secret:"true"`
+	Ignored string `label:"-"`
+	Other   []string
+	private string
+}
+
+func TestSettings(t *testing.T) {
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_workflow_data": t.TempDir()}, false)
+	secrets := &MemorySecretStore{}
+	w.SecretStore = secrets
+
+	settings := testSettings{Theme: "light", Limit: 10, Token: "secret"}
+	s, err := w.NewSettings("config", &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, _ := s.Items("", "")
+	want := []string{"☐ Enabled", "Theme: light", "Limit: 10", "Name: empty", "API token: ••••••••"}
+	if got := itemTitles(items); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Selecting a bool toggles it
+	out, err := s.Do(items[0].Arg.Data)
+	if err != nil || !settings.Enabled || out != "Enabled set to true" {
+		t.Errorf("toggle: got (%q, %v), enabled=%v", out, err, settings.Enabled)
+	}
+
+	// Enums list their options
+	items, _ = s.Items("", "Theme")
+	if got, want := itemTitles(items), []string{"☑ light", "☐ dark"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	s.Do(items[1].Arg.Data)
+	if settings.Theme != "dark" {
+		t.Errorf("got theme %q, want dark", settings.Theme)
+	}
+
+	// Ints are validated
+	items, _ = s.Items("abc", "Limit")
+	if items[0].Arg != nil {
+		t.Error("invalid int is actionable")
+	}
+	items, _ = s.Items("25", "Limit")
+	s.Do(items[0].Arg.Data)
+	if settings.Limit != 25 {
+		t.Errorf("got limit %d, want 25", settings.Limit)
+	}
+
+	// Secrets aren't displayed
+	items, _ = s.Items("hunter2", "Token")
+	if strings.Contains(items[0].Title, "hunter2") || strings.Contains(items[0].Subtitle, "secret") {
+		t.Errorf("secret was displayed: %+v", items[0])
+	}
+	s.Do(items[0].Arg.Data)
+
+	// Secrets are kept in the SecretStore
+	if token, err := secrets.Get("settings.Token"); err != nil || token != "hunter2" {
+		t.Errorf("got secret (%q, %v)", token, err)
+	}
+	var saved map[string]interface{}
+	settingsStore(&w).Get(settingsKey, &saved)
+	if saved["Token"] != "" {
+		t.Errorf("secret was saved with the settings: %v", saved)
+	}
+
+	// Settings are saved
+	var loaded testSettings
+	if _, err := w.NewSettings("config", &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Enabled || loaded.Theme != "dark" || loaded.Limit != 25 || loaded.Token != "hunter2" {
+		t.Errorf("got %+v", loaded)
+	}
+
+	// Settings don't use the workflow's own keys
+	if keys, _ := w.Store().Keys(); len(keys) != 0 {
+		t.Errorf("settings are in the root store: %q", keys)
+	}
+	w.Store().Set("settings", "mine")
+	if _, err := w.NewSettings("config", &loaded); err != nil || loaded.Theme != "dark" {
+		t.Errorf("got (%+v, %v) after setting a workflow key", loaded, err)
+	}
+}
+
+func TestSettingsValidation(t *testing.T) {
+	w := testWorkflow()
+
+	var notStruct string
+	if _, err := w.NewSettings("config", &notStruct); err == nil {
+		t.Error("expected an error for a non-struct")
+	}
+
+	var badEnum struct {
+		Mode int `options:"a,b"`
+	}
+	if _, err := w.NewSettings("config", &badEnum); err == nil {
+		t.Error("expected an error for an int enum")
+	}
+
+	var badSecret struct {
+		PIN int `secret:"true"`
+	}
+	if _, err := w.NewSettings("config", &badSecret); err == nil {
+		t.Error("expected an error for a non-string secret")
+	}
+}
+
+func itemTitles(items []Item) (titles []string) {
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	return
+}
@@ -0,0 +1,153 @@
+package alfred
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// DefaultSpillThreshold is the size, in bytes, above which an item's arg is
+// stored in the cache directory rather than being sent to Alfred
+const DefaultSpillThreshold = 8 * 1024
+
+// SpillMaxAge is how long a spilled arg is kept after it was last sent to
+// Alfred. It's longer than MaxCacheAge so that args in results cached by
+// Alfred remain available.
+const SpillMaxAge = 2 * MaxCacheAge
+
+// support -------------------------------------------------------------------
+
+// spillDir is the name of the subdirectory of the cache directory that holds
+// spilled args
+const spillDir = "spill"
+
+// spillGCInterval is the minimum time between cleanups of the spill directory
+const spillGCInterval = time.Hour
+
+// spiller stores oversized item args in a directory
+type spiller struct {
+	dir       string
+	threshold int
+}
+
+// spiller returns the spiller for a workflow's items, or nil if args
+// shouldn't be spilled
+func (w *Workflow) spiller() *spiller {
+	if w.cacheDir == "" || w.SpillThreshold < 0 {
+		return nil
+	}
+
+	threshold := w.SpillThreshold
+	if threshold == 0 {
+		threshold = DefaultSpillThreshold
+	}
+
+	return &spiller{dir: path.Join(w.cacheDir, spillDir), threshold: threshold}
+}
+
+// arg serializes workflow data for an item arg. If the result is larger than
+// the threshold, it's written to a file named by its hash, and a reference to
+// the file is returned instead. If the file can't be written, the full arg is
+// returned.
+func (s *spiller) arg(data workflowData) string {
+	arg := Stringify(data)
+	if s == nil || len(arg) <= s.threshold {
+		return arg
+	}
+
+	sum := sha256.Sum256([]byte(arg))
+	hash := hex.EncodeToString(sum[:])
+
+	if err := s.write(hash, arg); err != nil {
+		dlog.Printf("Error spilling arg: %v", err)
+		return arg
+	}
+
+	// Keep the mode so that a missing file can be reported appropriately
+	return Stringify(workflowData{Mode: data.Mode, Spill: hash})
+}
+
+// write stores an arg in the spill directory. Args are named by their hash,
+// so an existing file only needs to have its modification time updated.
+func (s *spiller) write(hash, arg string) (err error) {
+	filename := path.Join(s.dir, hash+".json")
+
+	now := time.Now()
+	if err = os.Chtimes(filename, now, now); err == nil {
+		return
+	}
+
+	if err = os.MkdirAll(s.dir, 0755); err != nil {
+		return
+	}
+
+	return writeFileAtomic(filename, []byte(arg), 0600)
+}
+
+// rehydrate replaces data that refers to a spilled arg with the arg's content
+func (w *Workflow) rehydrate(data *workflowData) (err error) {
+	hash := data.Spill
+
+	// Hashes are generated by spiller.arg; anything else could be used to
+	// read arbitrary files
+	if _, err = hex.DecodeString(hash); err != nil {
+		return fmt.Errorf("invalid spilled data reference '%s'", hash)
+	}
+
+	filename := path.Join(w.cacheDir, spillDir, hash+".json")
+
+	var content []byte
+	if content, err = os.ReadFile(filename); err != nil {
+		return &Error{
+			Title: "Item data is no longer available",
+			Hint:  "Run the search again",
+			Err:   err,
+		}
+	}
+
+	var spilled workflowData
+	if err = json.Unmarshal(content, &spilled); err != nil {
+		return
+	}
+
+	*data = spilled
+	return
+}
+
+// collectSpills removes spilled args that haven't been sent to Alfred in
+// SpillMaxAge. Cleanups are done at most once per spillGCInterval.
+func (w *Workflow) collectSpills() {
+	if w.cacheDir == "" {
+		return
+	}
+
+	dir := path.Join(w.cacheDir, spillDir)
+	stamp := path.Join(dir, ".gc")
+
+	if info, err := os.Stat(stamp); err == nil && time.Since(info.ModTime()) < spillGCInterval {
+		return
+	} else if os.IsNotExist(err) {
+		if _, err := os.Stat(dir); err != nil {
+			// Nothing has been spilled
+			return
+		}
+	}
+
+	if err := os.WriteFile(stamp, nil, 0600); err != nil {
+		dlog.Printf("Error updating spill cleanup time: %v", err)
+		return
+	}
+
+	files, _ := filepath.Glob(path.Join(dir, "*.json"))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > SpillMaxAge {
+			dlog.Printf("Removing spilled arg %s", file)
+			os.Remove(file)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package alfred
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bigFilter returns an item with a large payload
+type bigFilter struct{}
+
+func (bigFilter) About() CommandDef {
+	return CommandDef{Keyword: "big", IsEnabled: true}
+}
+
+func (bigFilter) Items(arg, data string) ([]Item, error) {
+	return []Item{
+		{Title: "big", Arg: &ItemArg{Keyword: "echo", Mode: ModeDo, Data: strings.Repeat("x", 100)}},
+		{Title: "small", Arg: &ItemArg{Keyword: "echo", Mode: ModeDo, Data: "y"}},
+	}, nil
+}
+
+// echoAction outputs its data
+type echoAction struct{}
+
+func (echoAction) About() CommandDef {
+	return CommandDef{Keyword: "echo", IsEnabled: true}
+}
+
+func (echoAction) Do(data string) (string, error) {
+	return data, nil
+}
+
+func TestSpill(t *testing.T) {
+	commands := []Command{bigFilter{}, echoAction{}}
+	env := Env{"alfred_version": "5.0", "alfred_workflow_cache": t.TempDir()}
+
+	run := func(args ...string) string {
+		w := testWorkflow()
+		w.SpillThreshold = 64
+		var out bytes.Buffer
+		w.RunWithOptions(commands, RunOptions{Args: args, Env: env, Stdout: &out})
+		return out.String()
+	}
+
+	var r testResponse
+	json.Unmarshal([]byte(run("", `{"keyword":"big"}`)), &r)
+	if len(r.Items) != 2 {
+		t.Fatalf("got %d items, want 2", len(r.Items))
+	}
+
+	big, small := r.Items[0].Arg, r.Items[1].Arg
+	if len(big) > 100 || !strings.Contains(big, `"spill":`) {
+		t.Errorf("big arg wasn't spilled: %s", big)
+	}
+	if strings.Contains(small, `"spill":`) {
+		t.Errorf("small arg was spilled: %s", small)
+	}
+
+	if got, want := run(big), strings.Repeat("x", 100)+"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Old spill files are removed, and missing ones are reported
+	files, _ := filepath.Glob(filepath.Join(env["alfred_workflow_cache"], spillDir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("got %d spill files, want 1", len(files))
+	}
+	old := time.Now().Add(-SpillMaxAge - time.Hour)
+	os.Chtimes(files[0], old, old)
+	os.Remove(filepath.Join(env["alfred_workflow_cache"], spillDir, ".gc"))
+
+	run("")
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Errorf("old spill file wasn't removed")
+	}
+
+	if got, want := run(big), "Item data is no longer available: Run the search again\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
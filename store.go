@@ -0,0 +1,208 @@
+package alfred
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned by Store.Get when a key has no value
+var ErrNotFound = errors.New("not found")
+
+// Store is a persistent key-value store. Each value is stored as JSON in its
+// own file, and is written atomically. Concurrent workflow processes are
+// coordinated with an advisory lock, so a Store may be shared by Filters,
+// Actions, and background jobs.
+//
+// Keys are namespaced. A Store's keys don't conflict with the keys of any of
+// its namespaces.
+type Store struct {
+	dir string
+}
+
+// Store returns the workflow's key-value store, which is kept in DataDir()
+func (w *Workflow) Store() *Store {
+	if w.dataDir == "" {
+		return &Store{}
+	}
+	return &Store{dir: path.Join(w.dataDir, "store")}
+}
+
+// Namespace returns a Store whose keys are separate from this Store's keys
+func (s *Store) Namespace(name string) *Store {
+	if s.dir == "" {
+		return &Store{}
+	}
+	return &Store{dir: path.Join(s.dir, escapeKey(name)+".d")}
+}
+
+// Get reads the value of a key into v. If the key has no value, ErrNotFound
+// is returned.
+func (s *Store) Get(key string, v interface{}) (err error) {
+	var unlock func()
+	if unlock, err = s.lock(false); err != nil {
+		return
+	}
+	defer unlock()
+
+	return s.read(key, v)
+}
+
+// Set sets the value of a key
+func (s *Store) Set(key string, v interface{}) (err error) {
+	var unlock func()
+	if unlock, err = s.lock(true); err != nil {
+		return
+	}
+	defer unlock()
+
+	return s.write(key, v)
+}
+
+// Update reads the value of a key into v, calls fn, and then stores v as the
+// new value. No other process can modify the Store in the meantime. If the key
+// has no value, v is left as is. If fn returns an error, the value isn't
+// changed.
+func (s *Store) Update(key string, v interface{}, fn func() error) (err error) {
+	var unlock func()
+	if unlock, err = s.lock(true); err != nil {
+		return
+	}
+	defer unlock()
+
+	if err = s.read(key, v); err != nil && err != ErrNotFound {
+		return
+	}
+
+	if err = fn(); err != nil {
+		return
+	}
+
+	return s.write(key, v)
+}
+
+// Delete removes a key. Deleting a key that has no value isn't an error.
+func (s *Store) Delete(key string) (err error) {
+	var unlock func()
+	if unlock, err = s.lock(true); err != nil {
+		return
+	}
+	defer unlock()
+
+	if err = os.Remove(s.filename(key)); os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// Keys returns the keys that have values, in sorted order
+func (s *Store) Keys() (keys []string, err error) {
+	var unlock func()
+	if unlock, err = s.lock(false); err != nil {
+		return
+	}
+	defer unlock()
+
+	var files []string
+	if files, err = filepath.Glob(path.Join(s.dir, "*.json")); err != nil {
+		return
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".json")
+		if key, err := url.PathUnescape(name); err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return
+}
+
+// support -------------------------------------------------------------------
+
+// cacheStore returns a Store for cached values, which is kept in CacheDir()
+func (w *Workflow) cacheStore() *Store {
+	return &Store{dir: w.cacheDir}
+}
+
+// errNoStore is returned when a workflow has no directory for a Store
+var errNoStore = errors.New("the workflow has no store directory")
+
+// lock takes the Store's advisory lock, creating the Store's directory if
+// necessary
+func (s *Store) lock(exclusive bool) (unlock func(), err error) {
+	if s.dir == "" {
+		return nil, errNoStore
+	}
+
+	if err = os.MkdirAll(s.dir, 0755); err != nil {
+		return
+	}
+
+	return lockFile(path.Join(s.dir, ".lock"), exclusive)
+}
+
+// read reads a key's value; the Store must be locked
+func (s *Store) read(key string, v interface{}) error {
+	data, err := os.ReadFile(s.filename(key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// write writes a key's value; the Store must be exclusively locked
+func (s *Store) write(key string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.filename(key), data, 0600)
+}
+
+// filename returns the name of the file holding a key's value
+func (s *Store) filename(key string) string {
+	return path.Join(s.dir, escapeKey(key)+".json")
+}
+
+// escapeKey makes a key safe to use as a file name
+func escapeKey(key string) string {
+	key = url.PathEscape(key)
+	// A leading '.' would make the file hidden
+	if strings.HasPrefix(key, ".") {
+		key = "%2E" + key[1:]
+	}
+	return key
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to filename,
+// so readers see either the old content or the new content
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) (err error) {
+	var tmp *os.File
+	if tmp, err = os.CreateTemp(path.Dir(filename), path.Base(filename)+".*.tmp"); err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
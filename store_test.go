@@ -0,0 +1,88 @@
+package alfred
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_workflow_data": t.TempDir()}, false)
+	store := w.Store()
+
+	var v string
+	if err := store.Get("missing", &v); err != ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+
+	keys := []string{"a", "b/c", ".hidden", "spaced key"}
+	for _, key := range keys {
+		if err := store.Set(key, "value of "+key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range keys {
+		if err := store.Get(key, &v); err != nil || v != "value of "+key {
+			t.Errorf("%q: got (%q, %v)", key, v, err)
+		}
+	}
+
+	// Namespaced keys are separate
+	ns := store.Namespace("a")
+	if err := ns.Get("a", &v); err != ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+	ns.Set("x", 1)
+
+	got, _ := store.Keys()
+	if want := []string{".hidden", "a", "b/c", "spaced key"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %q, want %q", got, want)
+	}
+
+	store.Delete("a")
+	if err := store.Get("a", &v); err != ErrNotFound {
+		t.Errorf("got %v after delete, want ErrNotFound", err)
+	}
+	if err := store.Delete("a"); err != nil {
+		t.Errorf("deleting a missing key: %v", err)
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_workflow_data": t.TempDir()}, false)
+	store := w.Store().Namespace("counters")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var n int
+			if err := store.Update("n", &n, func() error { n++; return nil }); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var n int
+	if store.Get("n", &n); n != 20 {
+		t.Errorf("got %d, want 20", n)
+	}
+
+	failed := errors.New("failed")
+	if err := store.Update("n", &n, func() error { n = 0; return failed }); err != failed {
+		t.Errorf("got %v, want %v", err, failed)
+	}
+	if store.Get("n", &n); n != 20 {
+		t.Errorf("failed update changed the value to %d", n)
+	}
+}
+
+func TestStoreWithoutDirectory(t *testing.T) {
+	w := testWorkflow()
+	if err := w.Store().Set("a", 1); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,15 @@
+package alfred
+
+import "testing"
+
+func TestUpdateAvailableWithoutRepository(t *testing.T) {
+	for _, website := range []string{"", "https://example.com", "https://github.com", "https://github.com/owner"} {
+		w := testWorkflow()
+		w.cacheDir = t.TempDir()
+		w.website = website
+
+		if _, available := w.UpdateAvailableNow(); available {
+			t.Errorf("%q: update available", website)
+		}
+	}
+}
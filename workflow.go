@@ -1,16 +1,15 @@
 package alfred
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
-	"sort"
+	"runtime"
 	"strings"
-	"text/template"
 	"time"
 )
 
@@ -23,8 +22,60 @@ const (
 	ModShift ModKey = "shift"
 	ModAlt   ModKey = "alt"
 	ModCtrl  ModKey = "ctrl"
+	ModFn    ModKey = "fn"
 )
 
+// modOrder is the order in which keys are listed in a modifier combination
+var modOrder = []ModKey{ModCmd, ModAlt, ModCtrl, ModShift, ModFn}
+
+// Mods combines modifier keys into a single ModKey, such as "cmd+shift", that
+// is active when all of the keys are held. Keys are listed in a consistent
+// order regardless of the order they're given in.
+func Mods(keys ...ModKey) ModKey {
+	var all []ModKey
+	for _, key := range keys {
+		all = append(all, key.Keys()...)
+	}
+
+	var parts []string
+	for _, key := range modOrder {
+		for _, k := range all {
+			if k == key {
+				parts = append(parts, string(key))
+				break
+			}
+		}
+	}
+
+	return ModKey(strings.Join(parts, "+"))
+}
+
+// With returns a combination of a ModKey and some additional keys
+func (m ModKey) With(keys ...ModKey) ModKey {
+	return Mods(append([]ModKey{m}, keys...)...)
+}
+
+// Keys returns the individual keys in a ModKey
+func (m ModKey) Keys() (keys []ModKey) {
+	if m == "" {
+		return
+	}
+	for _, key := range strings.Split(string(m), "+") {
+		keys = append(keys, ModKey(key))
+	}
+	return
+}
+
+// Has returns true if a ModKey includes a given key
+func (m ModKey) Has(key ModKey) bool {
+	for _, k := range m.Keys() {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
 // ModeType describes the workflow's current mode
 type ModeType string
 
@@ -42,32 +93,52 @@ type CommandDef struct {
 	Mods        map[ModKey]ItemMod
 	IsEnabled   bool
 	Arg         *ItemArg
-}
-
-var cache struct {
-	LastUpdateCheck time.Time
-	LatestRelease   GitHubRelease
+	// Timeout is the maximum amount of time the command's Items or Do method
+	// may run before it's abandoned. A zero Timeout means no limit.
+	Timeout time.Duration
+	// Searchable indicates that a Filter should receive the query in global
+	// search mode. Searchable children of enabled commands are searched too.
+	Searchable bool
+	// Children are sub-commands of this command. A child is addressed by its
+	// keyword path, the parent's keyword path followed by the child's
+	// keyword (e.g., "project list"). If a child has a custom Arg, its
+	// Keyword should be the child's full keyword path.
+	Children []Command
+	// Cache, if set, tells Alfred to cache the Filter's results. A Filter
+	// may override it at runtime with Workflow.SetCache.
+	Cache *ResultCache
+	// Aliases are alternate keywords for the command. They're matched in the
+	// keyword menu and when routing, but the command's keyword path always
+	// uses Keyword.
+	Aliases []string
+	// Hidden commands are routable by keyword but are never listed in the
+	// keyword menu.
+	Hidden bool
 }
 
 // KeywordItem creates a new Item for a command definition
 func (c *CommandDef) KeywordItem() (item Item) {
-	item.Title = c.Keyword
-	item.Autocomplete = c.Keyword
-	item.Subtitle = c.Description
+	return c.keywordItem("")
+}
 
-	if c.Arg != nil {
-		item.Arg = c.Arg
-	} else {
-		item.Arg = &ItemArg{Keyword: c.Keyword}
+// MatchesKeyword returns true if a word is the command's keyword or one of
+// its aliases
+func (c *CommandDef) MatchesKeyword(word string) bool {
+	if c.Keyword == word {
+		return true
 	}
-
-	if c.Mods != nil {
-		for key, mod := range c.Mods {
-			item.AddMod(key, mod)
+	for _, alias := range c.Aliases {
+		if alias == word {
+			return true
 		}
 	}
+	return false
+}
 
-	return
+// ChildKeywordItem creates a new Item for a command definition that is a
+// child of the command with the given keyword path
+func (c *CommandDef) ChildKeywordItem(parent string) (item Item) {
+	return c.keywordItem(parent)
 }
 
 // Command is a Filter or Action
@@ -87,9 +158,64 @@ type Action interface {
 	Do(data string) (string, error)
 }
 
+// ContextFilter is a Filter that accepts a context. The context is cancelled
+// when the command's Timeout expires. Run will call ItemsContext rather than
+// Items for commands that implement it.
+type ContextFilter interface {
+	Command
+	ItemsContext(ctx context.Context, arg, data string) ([]Item, error)
+}
+
+// ContextAction is an Action that accepts a context. The context is cancelled
+// when the command's Timeout expires. Run will call DoContext rather than Do
+// for commands that implement it.
+type ContextAction interface {
+	Command
+	DoContext(ctx context.Context, data string) (string, error)
+}
+
 // Workflow represents an Alfred workflow
 type Workflow struct {
-	UpdateIcon  string
+	UpdateIcon string
+
+	// MenuWorkers is the maximum number of commands that will be evaluated
+	// concurrently when building the keyword menu or global search results.
+	// If it's 0, the number of CPUs is used.
+	MenuWorkers int
+	// MenuTimeout is the total amount of time that may be spent building the
+	// keyword menu or global search results. Commands that haven't been
+	// evaluated when it expires are left out. A zero MenuTimeout means no
+	// limit.
+	MenuTimeout time.Duration
+	// Cache, if set, tells Alfred how to cache Script Filter results when a
+	// command doesn't specify its own cache settings
+	Cache *ResultCache
+	// Encoder, if set, encodes responses sent to Alfred. By default, an
+	// XMLEncoder is used for Alfred 2 and a JSONEncoder otherwise.
+	Encoder Encoder
+	// GlobalSearch enables global search mode. When no keyword has been
+	// selected, the query is also passed to every Searchable Filter, and the
+	// results are listed after the keyword menu.
+	GlobalSearch bool
+	// SpillThreshold is the size, in bytes, above which an item's arg is
+	// stored in the cache directory and replaced by a reference. Run restores
+	// spilled args when they're passed back to the workflow. If it's 0,
+	// DefaultSpillThreshold is used; if it's negative, args are never
+	// spilled.
+	SpillThreshold int
+	// SecretStore, if set, stores the workflow's passwords and other
+	// secrets. By default, the macOS Keychain is used on macOS, and an
+	// encrypted file in the data directory is used elsewhere.
+	SecretStore SecretStore
+	// Prompter, if set, shows the dialogs opened by GetConfirmation,
+	// GetInput, GetChoice, and ShowMessage. By default, an
+	// AppleScriptPrompter is used.
+	Prompter Prompter
+	// ScriptRunner, if set, runs the workflow's AppleScript and JavaScript
+	// for Automation scripts, including the scripts that show dialogs and
+	// notifications. By default, an OsascriptRunner is used.
+	ScriptRunner ScriptRunner
+
 	name        string
 	bundleID    string
 	cacheDir    string
@@ -98,33 +224,55 @@ type Workflow struct {
 	website     string
 	version     string
 	info        Plist
+	env         Env
+	stdout      io.Writer
+	middleware  []Middleware
+	state       *runState
+}
+
+// RunOptions configures a single invocation of RunWithOptions
+type RunOptions struct {
+	// Args are the workflow's command line arguments, not including the
+	// program name
+	Args []string
+	// Env, if not nil, replaces the workflow's environment for this run. The
+	// previous environment is restored when the run ends.
+	Env Env
+	// Stdout receives all output meant for Alfred. If nil, os.Stdout is used.
+	Stdout io.Writer
+	// Context is the parent context for Filter and Action calls. If nil,
+	// context.Background() is used.
+	Context context.Context
 }
 
 // OpenWorkflow returns a Workflow for a given directory. If the createDirs
 // option is true, cache and data directories will be created for the workflow.
+//
+// The workflow's environment is loaded with LoadEnv.
 func OpenWorkflow(workflowDir string, createDirs bool) (w Workflow, err error) {
-	bundleID := os.Getenv("alfred_workflow_bundleid")
-	name := os.Getenv("alfred_workflow_name")
-	cacheDir := os.Getenv("alfred_workflow_cache")
-	dataDir := os.Getenv("alfred_workflow_data")
+	var env Env
+	if env, err = LoadEnv(workflowDir); err != nil {
+		return
+	}
+	return OpenWorkflowWithEnv(workflowDir, env, createDirs)
+}
+
+// OpenWorkflowWithEnv returns a Workflow for a given directory using an
+// explicit environment rather than the process environment. If the createDirs
+// option is true, cache and data directories will be created for the workflow.
+func OpenWorkflowWithEnv(workflowDir string, env Env, createDirs bool) (w Workflow, err error) {
+	w = Workflow{workflowDir: workflowDir}
+	w.setEnv(env)
 
 	if createDirs {
-		if err = os.MkdirAll(cacheDir, 0755); err != nil {
+		if err = os.MkdirAll(w.cacheDir, 0755); err != nil {
 			return
 		}
-		if err = os.MkdirAll(dataDir, 0755); err != nil {
+		if err = os.MkdirAll(w.dataDir, 0755); err != nil {
 			return
 		}
 	}
 
-	w = Workflow{
-		name:        name,
-		bundleID:    bundleID,
-		cacheDir:    cacheDir,
-		dataDir:     dataDir,
-		workflowDir: workflowDir,
-	}
-
 	return
 }
 
@@ -139,6 +287,11 @@ func OpenWorkflow(workflowDir string, createDirs bool) (w Workflow, err error) {
 // Run takes one parameter: a list of Commands. Commands may be Filters or
 // Actions. Filters are commands that generate lists of items, while Actions
 // are commands that take an action.
+// ContextFilters and ContextActions are called with a context that expires
+// after their CommandDef's Timeout.
+//
+// Commands may have Children, which are addressed by keyword paths such as
+// "project list". Selecting a parent command lists its children.
 //
 // When the mode is "tell"...
 //   * ...and a keyword was specified in the incoming data, the Filter matching
@@ -148,21 +301,65 @@ func OpenWorkflow(workflowDir string, createDirs bool) (w Workflow, err error) {
 //     * any Filter with a fuzzy-matching keyword
 //     * any Action with a fuzzy-matching keyword and an Arg in its CommandDef
 //
+// Run reads its arguments from os.Args and writes to os.Stdout. Use
+// RunWithOptions to provide them explicitly.
 func (w *Workflow) Run(commands []Command) {
-	var mode ModeType
+	w.RunWithOptions(commands, RunOptions{Args: os.Args[1:]})
+}
+
+// RunWithOptions runs a workflow with explicit arguments, environment, and
+// output. It otherwise behaves the same as Run.
+func (w *Workflow) RunWithOptions(commands []Command, opts RunOptions) {
 	var final bool
 	var arg string
 	var rawArg string
+	var query string
 	var data workflowData
 	var keyword string
 	var prefix string
+	var parent string
+	var menu = commands
 	var err error
 
-	flag.BoolVar(&final, "final", false, "If true, act as the final workflow "+
-		"stage")
-	flag.Parse()
+	if opts.Env != nil {
+		env := w.env
+		w.setEnv(opts.Env)
+		defer w.setEnv(env)
+	}
+
+	w.stdout = opts.Stdout
+	w.state = &runState{cache: w.Cache, args: opts.Args}
+	defer func() { w.stdout, w.state = nil, nil }()
+	defer w.collectSpills()
+	out := w.output()
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Render panics in commands (or in Run itself) as error items rather than
+	// letting them kill the process
+	defer func() {
+		if p := recover(); p != nil {
+			w.handlePanic(capturePanic(p), data.Mode)
+		}
+	}()
+
+	if version := w.env["alfred_version"]; version != "" && !checkVersion(version) {
+		message := fmt.Sprintf("This workflow requires Alfred %s+", MinAlfredVersion)
+		dlog.Print(message)
+		w.SendToAlfred(Items{{Title: message}}, data)
+		return
+	}
 
-	args := flag.Args()
+	// Only a leading -final flag is recognized; anything else is part of the
+	// query, which may itself start with a '-'
+	args := opts.Args
+	if len(args) > 0 && (args[0] == "-final" || args[0] == "--final") {
+		final = true
+		args = args[1:]
+	}
 
 	if len(args) == 1 {
 		// If there's only 1 arg, try to decode it as a workflow data object,
@@ -171,7 +368,7 @@ func (w *Workflow) Run(commands []Command) {
 			dlog.Printf("Couldn't parse first arg as data: %v", err)
 			arg = args[0]
 		}
-	} else if len(args) > 1 {
+	} else if len(args) == 2 {
 		// If there are 2 args, the second must be a workflow data object. Use
 		// the first as `arg` even if the data object contains an Arg value.
 		arg = args[0]
@@ -181,10 +378,15 @@ func (w *Workflow) Run(commands []Command) {
 				dlog.Printf("Couldn't parse second arg as data: %v", err)
 			}
 		}
-	} else {
+	} else if len(args) > 2 {
 		err = fmt.Errorf("More than 2 args were provided; only 2 are accepted")
 	}
 
+	if err == nil && data.Spill != "" {
+		dlog.Printf("restoring spilled data %s", data.Spill)
+		err = w.rehydrate(&data)
+	}
+
 	if err == nil {
 		// If this is the final step in the workflow, the data should be
 		// actionable
@@ -193,15 +395,20 @@ func (w *Workflow) Run(commands []Command) {
 				data.Mode = ModeTell
 			}
 
+			var backArg string
+
 			if data.Mode == ModeBack {
 				dlog.Printf("going back")
-				json.Unmarshal([]byte(data.Data), &data)
+				backArg = data.back()
 			}
 
 			if data.Mode == ModeBack || data.Mode == ModeTell {
 				var block blockConfig
-				block.AlfredWorkflow.Variables.Data = Stringify(&data)
-				fmt.Printf("-trigger %s", Stringify(&block))
+				block.AlfredWorkflow.Arg = backArg
+				block.AlfredWorkflow.Variables = map[string]string{
+					"data": Stringify(&data),
+				}
+				fmt.Fprintf(out, "-trigger %s", Stringify(&block))
 				return
 			}
 		}
@@ -211,6 +418,20 @@ func (w *Workflow) Run(commands []Command) {
 			data.Mode = ModeTell
 		}
 
+		// A back item may be connected directly to a Script Filter rather
+		// than going through the final stage
+		if data.Mode == ModeBack {
+			dlog.Printf("going back")
+			arg = data.back()
+			rawArg = arg
+		}
+
+		w.state.stack = data.Stack
+		w.state.title = data.Title
+		if w.state.title == "" {
+			w.state.title = data.Keyword
+		}
+
 		keyword = data.Keyword
 		dlog.Printf("set keyword to '%s'", keyword)
 
@@ -218,13 +439,21 @@ func (w *Workflow) Run(commands []Command) {
 		// of the argument. The keyword part of the argument will become the
 		// prefix, and the remainder will be passed to Items or Do as the arg
 		if keyword == "" {
-			cmd, rest := SplitCmd(arg)
+			query = strings.Trim(arg, " ")
+
+			// Leading words that name commands with children select the
+			// level of the command tree the keyword is taken from
+			var level string
+			parent, menu, level = splitKeywordPath(commands, arg)
+
+			cmd, rest := SplitCmd(level)
 			keyword = cmd
 
-			// Use the keyword as the prefix. If the arg has more characters
-			// than the keyword, there must be a space after the keyword.
-			prefix = keyword
-			if len(arg) > len(keyword) {
+			// Use the keyword path as the prefix. If the arg has more
+			// characters than the keyword, there must be a space after the
+			// keyword.
+			prefix = joinKeyword(parent, keyword)
+			if len(level) > len(keyword) {
 				prefix += " "
 			}
 
@@ -235,6 +464,11 @@ func (w *Workflow) Run(commands []Command) {
 		}
 	}
 
+	// Errors are reported as items in 'tell' mode
+	if data.Mode == "" {
+		data.Mode = ModeTell
+	}
+
 	switch data.Mode {
 	case "tell":
 		var items Items
@@ -242,37 +476,43 @@ func (w *Workflow) Run(commands []Command) {
 		if err == nil {
 			dlog.Printf("tell: data=%#v, arg='%s'", data, arg)
 
-			for _, c := range commands {
-				def := c.About()
-
-				// Skip disabled commands
-				if !def.IsEnabled {
-					dlog.Printf("Skipping disabled command '%s'", def.Keyword)
-					continue
+			if data.Keyword != "" {
+				if _, def, ok := findCommand(commands, data.Keyword, nil); ok {
+					// A parent command lists its children
+					if len(def.Children) > 0 {
+						dlog.Printf("Adding child items for '%s'", data.Keyword)
+						items = w.menuItems(ctx, def.Children, data.Keyword, arg)
+						FuzzySort(items, arg)
+					}
 				}
 
-				if data.Keyword != "" {
-					if f, ok := c.(Filter); ok && def.Keyword == data.Keyword {
-						dlog.Printf("Adding items for '%s'", def.Keyword)
-						var filterItems []Item
-						if filterItems, err = f.Items(arg, data.Data); err == nil {
-							for _, i := range filterItems {
-								items = append(items, i)
-
-								// Add the prefix to Autocomplete strings
-								if i.Autocomplete != "" {
-									i.Autocomplete = prefix + i.Autocomplete
-								}
+				if c, def, ok := findCommand(commands, data.Keyword, isFilter); ok {
+					dlog.Printf("Adding items for '%s'", data.Keyword)
+					if def.Cache != nil {
+						w.SetCache(*def.Cache)
+					}
+					var filterItems []Item
+					if filterItems, err = w.invokeFilter(ctx, &Invocation{
+						Keyword: data.Keyword,
+						Command: c,
+						Def:     def,
+						Mode:    data.Mode,
+						Mod:     data.Mod,
+						Arg:     arg,
+						Data:    data.Data,
+					}); err == nil {
+						for _, i := range filterItems {
+							items = append(items, i)
+
+							// Add the prefix to Autocomplete strings
+							if i.Autocomplete != "" {
+								i.Autocomplete = prefix + i.Autocomplete
 							}
 						}
 					}
-				} else if FuzzyMatches(def.Keyword, keyword) {
-					if _, ok := c.(Filter); ok || def.Arg != nil {
-						dlog.Printf("Adding menu item for '%s'", def.Keyword)
-						item := def.KeywordItem()
-						items = append(items, item)
-					}
 				}
+			} else {
+				items = w.menuItems(ctx, menu, parent, keyword)
 			}
 
 			// Only add the update item if the query matches "update"
@@ -286,15 +526,28 @@ func (w *Workflow) Run(commands []Command) {
 					FuzzySort(items, keyword)
 				}
 			}
+
+			if w.GlobalSearch && data.Keyword == "" && query != "" {
+				items = append(items, w.searchItems(ctx, commands, query)...)
+			}
 		}
 
 		if err != nil {
 			dlog.Printf("Error: %s", err)
-			items = append(items, Item{Title: fmt.Sprintf("Error: %s", err)})
+			items = append(items, errorItem(err))
+
+			// Alfred shouldn't serve an error from its cache
+			w.disableCache()
 		} else if len(items) == 0 {
 			items = append(items, Item{Title: fmt.Sprintf("No results")})
 		}
 
+		// Items that push a view need to know the current query. The keyword
+		// menu and global search results are a view of the whole query.
+		data.Arg = arg
+		if data.Keyword == "" {
+			data.Arg = query
+		}
 		w.SendToAlfred(items, data)
 
 	case "do":
@@ -306,57 +559,56 @@ func (w *Workflow) Run(commands []Command) {
 			if keyword == "alfred.open" {
 				dlog.Printf("opening %s", data.Data)
 				err = exec.Command("open", data.Data).Run()
+			} else if keyword == "alfred.copy" {
+				dlog.Printf("copying %d bytes to the clipboard", len(data.Data))
+				cmd := exec.Command("pbcopy")
+				cmd.Stdin = strings.NewReader(data.Data)
+				err = cmd.Run()
 			} else {
-				var action Action
-
-				for _, c := range commands {
-					def := c.About()
-
-					// Skip disabled commands
-					if !def.IsEnabled {
-						continue
-					}
-
-					if a, ok := c.(Action); ok {
-						dlog.Printf("Checking if '%s' == '%s'", a.About().Keyword,
-							keyword)
-						if def.Keyword == keyword {
-							action = a
-							break
-						}
-					}
-				}
+				path := joinKeyword(parent, keyword)
+				dlog.Printf("Looking for action '%s'", path)
 
-				if action == nil {
+				if action, def, ok := findCommand(commands, path, isAction); !ok {
 					err = fmt.Errorf("No valid command in '%s'", arg)
 				} else {
-					output, err = action.Do(data.Data)
+					output, err = w.invokeAction(ctx, &Invocation{
+						Keyword: path,
+						Command: action,
+						Def:     def,
+						Mode:    data.Mode,
+						Mod:     data.Mod,
+						Data:    data.Data,
+					})
 				}
 			}
 		}
 
 		if err != nil {
-			output = fmt.Sprintf("Error: %s", err)
+			dlog.Printf("Error: %s", err)
+			output = errorMessage(err)
+		}
+
+		// If the action set any workflow variables, pass them and the output
+		// to downstream objects in an alfredworkflow object
+		if vars := w.variables(); len(vars) > 0 {
+			var block blockConfig
+			block.AlfredWorkflow.Arg = output
+			block.AlfredWorkflow.Variables = vars
+			output = Stringify(&block)
 		}
 
 		if output != "" {
-			fmt.Println(output)
+			fmt.Fprintln(out, output)
 		}
 
 	default:
-		fmt.Printf("Invalid mode: '%s'\n", mode)
+		fmt.Fprintf(out, "Invalid mode: '%s'\n", data.Mode)
 	}
 }
 
-// AddPassword adds or updates a password in the macOS Keychain
-func (w *Workflow) AddPassword(name, password string) (err error) {
-	var out []byte
-	out, err = exec.Command("security", "add-generic-password", "-w", "-g",
-		"-a", w.bundleID, "-s", name, "-w", password, "-U").Output()
-	if err != nil {
-		dlog.Printf("Error adding password: %s", string(out))
-	}
-	return
+// AddPassword adds or updates a password in the workflow's SecretStore
+func (w *Workflow) AddPassword(name, password string) error {
+	return w.Secrets().Set(name, password)
 }
 
 // AddUpdateItem performs an update check and adds an update item to the given
@@ -448,164 +700,479 @@ func (w *Workflow) UpdateAvailableNow() (release GitHubRelease, available bool)
 	return w.updateAvailable(true)
 }
 
+// GetChoice opens a dialog to ask the user to choose from a list of options.
+// If the user cancels the dialog, chosen is nil.
+func (w *Workflow) GetChoice(prompt string, options []string, multiple bool) (chosen []string, err error) {
+	if chosen, err = w.prompter().Choose(prompt, options, multiple); err == ErrCanceled {
+		return nil, nil
+	}
+	return
+}
+
 // GetConfirmation opens a confirmation dialog to ask the user to confirm
 // something.
 func (w *Workflow) GetConfirmation(prompt string, defaultYes bool) (confirmed bool, err error) {
-	version := os.Getenv("alfred_short_version")
-	type ScriptData struct {
-		Version string
-		Prompt  string
-		Title   string
-		Default string
-	}
-
-	script :=
-		`tell application "Alfred {{.Version}}"
-			  activate
-			  set alfredPath to (path to application "Alfred {{.Version}}")
-			  set alfredIcon to path to resource "appicon.icns" in bundle (alfredPath as alias)
-			  display dialog "{{.Prompt}}" with title "{{.Title}}" buttons {"Yes", "No"} default button "{{.Default}}" with icon alfredIcon
-		  end tell`
-
-	data := ScriptData{version, prompt, w.name, "No"}
+	defaultButton := "No"
 	if defaultYes {
-		data.Default = "Yes"
+		defaultButton = "Yes"
 	}
 
-	var tmpl *template.Template
-	tmpl, err = template.New("script").Parse(script)
-	if err != nil {
-		return
+	var button string
+	if button, err = w.prompter().Ask(prompt, []string{"Yes", "No"}, defaultButton); err == ErrCanceled {
+		return false, nil
 	}
+	return button == "Yes", err
+}
 
-	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, data)
-	if err != nil {
+// GetInput opens an input dialog to ask the user for some information. If
+// the user cancels the dialog, button is "Cancel"; otherwise it's "Ok".
+func (w *Workflow) GetInput(prompt, defaultVal string, hideAnswer bool) (button, value string, err error) {
+	if value, err = w.prompter().Input(prompt, defaultVal, hideAnswer); err == ErrCanceled {
+		dlog.Printf("User canceled")
+		return "Cancel", "", nil
+	} else if err != nil {
 		return
 	}
+	return "Ok", value, nil
+}
 
-	script = buf.String()
-	var response string
-	response, err = RunScript(script)
-	if err != nil {
-		return
+// GetPassword returns a workflow-specific password from the workflow's
+// SecretStore
+func (w *Workflow) GetPassword(name string) (string, error) {
+	return w.Secrets().Get(name)
+}
+
+// DeletePassword removes a password from the workflow's SecretStore
+func (w *Workflow) DeletePassword(name string) error {
+	return w.Secrets().Delete(name)
+}
+
+// SendToAlfred sends an array of items to Alfred. The items are encoded with
+// the workflow's Encoder (XML for Alfred 2, JSON otherwise) and written to
+// stdout (or to the writer given to RunWithOptions). Any rerun interval,
+// cache directive, or variables set during the run are included in the
+// response.
+func (w *Workflow) SendToAlfred(items Items, data workflowData) {
+	spill := w.spiller()
+	for i := range items {
+		items[i].data = data
+		items[i].spill = spill
 	}
+	if err := w.encoder().Encode(w.output(), w.response(items)); err != nil {
+		dlog.Printf("Error sending items: %v", err)
+	}
+}
 
-	button, _ := parseDialogResponse(response)
-	return button == "Yes", nil
+// ShowMessage opens a message dialog to show the user a message.
+func (w *Workflow) ShowMessage(message string) error {
+	return w.prompter().Message(message)
 }
 
-// GetInput opens an input dialog to ask the user for some information.
-func (w *Workflow) GetInput(prompt, defaultVal string, hideAnswer bool) (button, value string, err error) {
-	script :=
-		`tell application "Alfred {{.Version}}"
-			  activate
-			  set alfredPath to (path to application "Alfred {{.Version}}")
-			  set alfredIcon to path to resource "appicon.icns" in bundle (alfredPath as alias)
-			  display dialog "{{.Prompt}}:" with title "{{.Title}}" default answer "{{.Default}}" buttons {"Cancel", "Ok"} default button "Ok" with icon alfredIcon{{.Hidden}}
-		  end tell`
-
-	data := struct {
-		Version string
-		Prompt  string
-		Title   string
-		Default string
-		Hidden  string
-	}{os.Getenv("alfred_short_version"), prompt, w.name, defaultVal, ""}
-
-	if hideAnswer {
-		data.Hidden = " with hidden answer"
-	}
-
-	var tmpl *template.Template
-	tmpl, err = template.New("script").Parse(script)
-	if err != nil {
-		return
+// support -------------------------------------------------------------------
+
+// isFilter returns true if a command is a Filter or ContextFilter
+func isFilter(c Command) bool {
+	if _, ok := c.(ContextFilter); ok {
+		return true
 	}
+	_, ok := c.(Filter)
+	return ok
+}
 
-	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, data)
-	if err != nil {
-		return
+// isAction returns true if a command is an Action or ContextAction
+func isAction(c Command) bool {
+	if _, ok := c.(ContextAction); ok {
+		return true
 	}
+	_, ok := c.(Action)
+	return ok
+}
 
-	script = buf.String()
-	var response string
-	response, err = RunScript(script)
-	dlog.Printf("got response: '%s'", response)
-	if err != nil {
-		if strings.Contains(response, "User canceled") {
-			dlog.Printf("User canceled")
-			return "Cancel", "", nil
+// menuItems returns keyword items for the enabled commands whose keywords
+// fuzzy match a query. The commands are children of the command with the
+// given keyword path, or top-level commands if it's empty. Commands are
+// evaluated concurrently, but the items are returned in the same order as the
+// commands.
+func (w *Workflow) menuItems(ctx context.Context, commands []Command, parent, query string) (items Items) {
+	results := w.evalCommands(ctx, commands, func(ctx context.Context, c Command) interface{} {
+		if item, ok := menuItem(c, parent, query); ok {
+			return item
+		}
+		return nil
+	})
+
+	for _, r := range results {
+		if item, ok := r.(Item); ok {
+			items = append(items, item)
 		}
-		return
 	}
 
-	button, value = parseDialogResponse(response)
 	return
 }
 
-// GetPassword returns a workflow-specific password from the macOS Keychain
-func (w *Workflow) GetPassword(name string) (pw string, err error) {
-	var out []byte
-	out, err = exec.Command("security", "find-generic-password", "-w", "-g",
-		"-a", w.bundleID, "-s", name).Output()
-	if err != nil {
-		dlog.Printf("Error getting password: %s", string(out))
-		return
+// searchItems passes a query to every enabled, searchable Filter in a command
+// tree and merges the results. Each command's items are grouped under a header
+// item, and items with a UID that was already seen are dropped.
+func (w *Workflow) searchItems(ctx context.Context, commands []Command, query string) (items Items) {
+	type result struct {
+		path  string
+		items []Item
+	}
+
+	results := w.evalCommands(ctx, searchCommands(commands, ""), func(ctx context.Context, c Command) interface{} {
+		sc := c.(searchCommand)
+		def := sc.About()
+
+		dlog.Printf("Searching '%s' for '%s'", sc.path, query)
+		found, err := w.invokeFilter(ctx, &Invocation{
+			Keyword: sc.path,
+			Command: sc.Command,
+			Def:     def,
+			Mode:    ModeTell,
+			Arg:     query,
+		})
+		if err != nil {
+			dlog.Printf("Error searching '%s': %v", sc.path, err)
+			return nil
+		}
+
+		return result{sc.path, found}
+	})
+
+	seen := map[string]bool{}
+
+	for _, r := range results {
+		res, ok := r.(result)
+		if !ok {
+			continue
+		}
+
+		var section Items
+		for _, item := range res.items {
+			if item.UID != "" {
+				if seen[item.UID] {
+					continue
+				}
+				seen[item.UID] = true
+			}
+
+			// Items belong to the command that generated them unless their
+			// Arg names another keyword
+			item.command = res.path
+			section = append(section, item)
+		}
+
+		if len(section) > 0 {
+			items = append(items, Item{
+				Title:        res.path,
+				Subtitle:     Line,
+				Autocomplete: res.path,
+			})
+			items = append(items, section...)
+		}
 	}
-	pw = strings.TrimSpace(string(out))
+
 	return
 }
 
-// SendToAlfred sends an array of items to Alfred. Currently this equates to
-// outputting an Alfred JSON message on stdout.
-func (w *Workflow) SendToAlfred(items Items, data workflowData) {
-	for _, item := range items {
-		item.data = data
+// searchCommand is a searchable Filter and its keyword path
+type searchCommand struct {
+	Command
+	path string
+}
+
+// searchCommands returns the enabled, searchable Filters in a command tree
+// whose root has the given keyword path
+func searchCommands(commands []Command, parent string) (found []Command) {
+	for _, c := range commands {
+		def := c.About()
+		if !def.IsEnabled {
+			continue
+		}
+
+		path := joinKeyword(parent, def.Keyword)
+		if def.Searchable && isFilter(c) {
+			found = append(found, searchCommand{c, path})
+		}
+		found = append(found, searchCommands(def.Children, path)...)
 	}
-	out, _ := json.Marshal(items)
-	fmt.Println(string(out))
+	return
 }
 
-// ShowMessage opens a message dialog to show the user a message.
-func (w *Workflow) ShowMessage(message string) (err error) {
-	script :=
-		`tell application "Alfred {{.Version}}"
-			  activate
-			  set alfredPath to (path to application "Alfred {{.Version}}")
-			  set alfredIcon to path to resource "appicon.icns" in bundle (alfredPath as alias)
-			  display dialog "{{.Prompt}}" with title "{{.Title}}" buttons {"Ok"} default button "Ok" with icon alfredIcon
-		  end tell`
-
-	data := struct {
-		Version string
-		Prompt  string
-		Title   string
-	}{os.Getenv("alfred_short_version"), message, w.name}
-
-	var tmpl *template.Template
-	tmpl, err = template.New("script").Parse(script)
-	if err != nil {
+// evalCommands calls fn for each command using at most w.MenuWorkers
+// goroutines, and returns the results in command order. If w.MenuTimeout
+// expires before every command has been evaluated, the results for the
+// remaining commands will be nil.
+func (w *Workflow) evalCommands(ctx context.Context, commands []Command, fn func(context.Context, Command) interface{}) []interface{} {
+	type result struct {
+		index int
+		value interface{}
+		panic *panicError
+	}
+
+	workers := w.MenuWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	if w.MenuTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.MenuTimeout)
+		defer cancel()
+	}
+
+	jobs := make(chan int, len(commands))
+	for i := range commands {
+		jobs <- i
+	}
+	close(jobs)
+
+	done := make(chan result, len(commands))
+	for n := 0; n < workers; n++ {
+		go func() {
+			for i := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				done <- func() (r result) {
+					r.index = i
+					defer func() {
+						if p := recover(); p != nil {
+							r.panic = capturePanic(p)
+						}
+					}()
+					r.value = fn(ctx, commands[i])
+					return
+				}()
+			}
+		}()
+	}
+
+	results := make([]interface{}, len(commands))
+
+collect:
+	for remaining := len(commands); remaining > 0; remaining-- {
+		select {
+		case r := <-done:
+			if r.panic != nil {
+				panic(r.panic)
+			}
+			results[r.index] = r.value
+		case <-ctx.Done():
+			dlog.Printf("Timed out with %d commands remaining", remaining)
+			break collect
+		}
+	}
+
+	return results
+}
+
+// menuItem returns a keyword item for a command if it's enabled and its
+// keyword fuzzy matches a query
+func menuItem(c Command, parent, query string) (item Item, ok bool) {
+	def := c.About()
+
+	// Skip disabled and hidden commands
+	if !def.IsEnabled || def.Hidden {
+		dlog.Printf("Skipping disabled or hidden command '%s'", def.Keyword)
 		return
 	}
 
-	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, data)
-	if err != nil {
+	keywords := append([]string{def.Keyword}, def.Aliases...)
+	if !FuzzyMatchesAny(keywords, query) {
 		return
 	}
 
-	script = buf.String()
-	_, err = RunScript(script)
+	if isFilter(c) || def.Arg != nil || len(def.Children) > 0 {
+		dlog.Printf("Adding menu item for '%s'", joinKeyword(parent, def.Keyword))
+		return def.keywordItem(parent), true
+	}
+
 	return
 }
 
-// support -------------------------------------------------------------------
+// keywordItem creates a new Item for a command definition whose parent has
+// the given keyword path
+func (c *CommandDef) keywordItem(parent string) (item Item) {
+	path := joinKeyword(parent, c.Keyword)
+
+	item.Title = c.Keyword
+	item.Autocomplete = path
+	item.Subtitle = c.Description
+	item.fuzzyKeys = c.Aliases
+
+	// Parent commands autocomplete to their children
+	if len(c.Children) > 0 {
+		item.Autocomplete += " "
+	}
+
+	if c.Arg != nil {
+		item.Arg = c.Arg
+	} else {
+		item.Arg = &ItemArg{Keyword: path}
+	}
+
+	if c.Mods != nil {
+		for key, mod := range c.Mods {
+			item.AddMod(key, mod)
+		}
+	}
+
+	return
+}
+
+// joinKeyword appends a keyword to a keyword path
+func joinKeyword(parent, keyword string) string {
+	if parent == "" {
+		return keyword
+	}
+	if keyword == "" {
+		return parent
+	}
+	return parent + " " + keyword
+}
+
+// findCommand returns the enabled command with a given keyword path. If want
+// is not nil, the command must also satisfy it.
+func findCommand(commands []Command, path string, want func(Command) bool) (cmd Command, def CommandDef, found bool) {
+	words := strings.Fields(path)
+
+	for i, word := range words {
+		last := i == len(words)-1
+		found = false
+
+		for _, c := range commands {
+			d := c.About()
+			if !d.IsEnabled || !d.MatchesKeyword(word) {
+				continue
+			}
+			if last && want != nil && !want(c) {
+				continue
+			}
+			cmd, def, found = c, d, true
+			break
+		}
+
+		if !found {
+			return nil, CommandDef{}, false
+		}
+
+		commands = def.Children
+	}
+
+	return
+}
+
+// splitKeywordPath consumes the leading words of an argument that name
+// commands with children. It returns the keyword path of the deepest such
+// command, that command's children, and the remainder of the argument. Only
+// words followed by a space are consumed, so a partially typed keyword is left
+// in the remainder.
+func splitKeywordPath(commands []Command, arg string) (path string, children []Command, rest string) {
+	children = commands
+	rest = strings.TrimLeft(arg, " ")
+
+	for {
+		word, _ := SplitCmd(rest)
+		if word == "" || !strings.HasPrefix(rest[len(word):], " ") {
+			return
+		}
+
+		// SplitCmd trims the tail, which would drop the space after a
+		// trailing keyword
+		tail := strings.TrimLeft(rest[len(word):], " ")
+
+		var next []Command
+		for _, c := range children {
+			def := c.About()
+			if def.IsEnabled && def.MatchesKeyword(word) && len(def.Children) > 0 {
+				word = def.Keyword
+				next = def.Children
+				break
+			}
+		}
+
+		if next == nil {
+			return
+		}
+
+		path = joinKeyword(path, word)
+		children = next
+		rest = tail
+	}
+}
+
+// commandContext returns a context for a call to a command, applying the
+// command's timeout if it has one
+func commandContext(ctx context.Context, def CommandDef) (context.Context, context.CancelFunc) {
+	if def.Timeout > 0 {
+		return context.WithTimeout(ctx, def.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// commandError describes why a command was abandoned. If own is true, the
+// command's own timeout expired rather than a deadline set by the caller.
+func commandError(def CommandDef, err error, own bool) error {
+	if err == context.DeadlineExceeded {
+		hint := fmt.Sprintf("'%s' ran out of time", def.Keyword)
+		if own && def.Timeout > 0 {
+			hint = fmt.Sprintf("'%s' took longer than %v", def.Keyword, def.Timeout)
+		}
+		return &Error{
+			Title:    "Timed out",
+			Hint:     hint,
+			Severity: SeverityWarning,
+			Err:      err,
+		}
+	}
+	return &Error{
+		Title:    "Cancelled",
+		Hint:     fmt.Sprintf("'%s' was cancelled", def.Keyword),
+		Severity: SeverityWarning,
+		Err:      err,
+	}
+}
+
+// callFilter gets items from a Filter or ContextFilter
+func callFilter(ctx context.Context, c Command, arg, data string) ([]Item, error) {
+	if f, ok := c.(ContextFilter); ok {
+		return f.ItemsContext(ctx, arg, data)
+	}
+	return c.(Filter).Items(arg, data)
+}
+
+// callAction runs an Action or ContextAction
+func callAction(ctx context.Context, c Command, data string) (string, error) {
+	if a, ok := c.(ContextAction); ok {
+		return a.DoContext(ctx, data)
+	}
+	return c.(Action).Do(data)
+}
+
+// output returns the writer that output for Alfred should be sent to
+func (w *Workflow) output() io.Writer {
+	if w.stdout != nil {
+		return w.stdout
+	}
+	return os.Stdout
+}
+
+// setEnv sets a workflow's environment and the properties derived from it
+func (w *Workflow) setEnv(env Env) {
+	w.env = env
+	w.name = env["alfred_workflow_name"]
+	w.bundleID = env["alfred_workflow_bundleid"]
+	w.cacheDir = env["alfred_workflow_cache"]
+	w.dataDir = env["alfred_workflow_data"]
+}
 
 func (w *Workflow) plist() (p Plist, err error) {
 	if w.info["version"] == nil {
-		plist := LoadPlist("info.plist")
+		var plist Plist
+		if plist, err = readPlist(path.Join(w.workflowDir, "info.plist")); err != nil {
+			return
+		}
 		w.info = plist
 	}
 
@@ -616,27 +1183,44 @@ func (w *Workflow) plist() (p Plist, err error) {
 // blockConfig is a struct used by Alfred to configure blocks
 type blockConfig struct {
 	AlfredWorkflow struct {
-		Arg       string `json:"arg"`
-		Variables struct {
-			Data string `json:"data,omitempty"`
-		} `json:"variables,omitempty"`
+		Arg       string            `json:"arg"`
+		Variables map[string]string `json:"variables,omitempty"`
 	} `json:"alfredworkflow"`
 }
 
 // workflowData describes the state of the workflow. It is used to communicate
-// between workflow instances. All the elements of this structure should be
-// primitives to allow easy copying.
+// between workflow instances. All the elements of this structure other than
+// Stack should be primitives to allow easy copying; Stack must be copied
+// before it's modified.
 type workflowData struct {
 	Keyword string   `json:"keyword,omitempty"`
 	Mode    ModeType `json:"mode,omitempty"`
 	Mod     ModKey   `json:"mod,omitempty"`
 	// Data is keyword-specific data
 	Data string `json:"data,omitempty"`
+	// Title is the title of the current view
+	Title string `json:"title,omitempty"`
+	// Stack holds the views that can be returned to with ModeBack
+	Stack []navFrame `json:"stack,omitempty"`
+	// Arg is the current query. It's only used to record the query when a
+	// view is pushed, and is never serialized.
+	Arg string `json:"-"`
+	// Spill is the hash of a spilled arg. If it's set, the rest of the data
+	// is stored in the cache directory.
+	Spill string `json:"spill,omitempty"`
+}
+
+// updateCache records the result of the last update check
+type updateCache struct {
+	LastUpdateCheck time.Time
+	LatestRelease   GitHubRelease
 }
 
 func (w *Workflow) updateAvailable(checkNow bool) (release GitHubRelease, available bool) {
-	cacheFile := path.Join(w.CacheDir(), "workflow_cache.json")
-	if err := LoadJSON(cacheFile, &cache); err == nil {
+	store := w.cacheStore()
+
+	var cache updateCache
+	if err := store.Get("workflow_cache", &cache); err == nil {
 		dlog.Println("loaded cache")
 	}
 
@@ -644,9 +1228,17 @@ func (w *Workflow) updateAvailable(checkNow bool) (release GitHubRelease, availa
 		cache.LastUpdateCheck = time.Now()
 
 		website := w.Website()
-		parts := sort.StringSlice(strings.Split(website, "/"))
-		i := parts.Search("github.com")
-		if i == -1 {
+		// The website must be a GitHub repository URL. The parts aren't
+		// sorted, so they have to be searched linearly.
+		parts := strings.Split(website, "/")
+		i := -1
+		for j, part := range parts {
+			if part == "github.com" {
+				i = j
+				break
+			}
+		}
+		if i == -1 || i+2 >= len(parts) {
 			dlog.Printf("Can't parse website '%s'", website)
 			return
 		}
@@ -667,7 +1259,7 @@ func (w *Workflow) updateAvailable(checkNow bool) (release GitHubRelease, availa
 			cache.LatestRelease = GitHubRelease{}
 		}
 
-		if err := SaveJSON(cacheFile, &cache); err != nil {
+		if err := store.Set("workflow_cache", &cache); err != nil {
 			dlog.Printf("Error saving cache: %s", err)
 		}
 	}
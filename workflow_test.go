@@ -0,0 +1,479 @@
+package alfred
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testFilter struct {
+	keyword string
+}
+
+func (f testFilter) About() CommandDef {
+	return CommandDef{Keyword: f.keyword, IsEnabled: true}
+}
+
+func (f testFilter) Items(arg, data string) ([]Item, error) {
+	return []Item{{Title: f.keyword + ":" + arg + ":" + data}}, nil
+}
+
+type testAction struct {
+	keyword string
+}
+
+func (a testAction) About() CommandDef {
+	return CommandDef{Keyword: a.keyword, IsEnabled: true}
+}
+
+func (a testAction) Do(data string) (string, error) {
+	return a.keyword + " did " + data, nil
+}
+
+// testResponse is the part of a Script Filter response the tests look at
+type testResponse struct {
+	Items []struct {
+		Title string `json:"title"`
+		Arg   string `json:"arg"`
+	} `json:"items"`
+}
+
+// testWorkflow returns a workflow that doesn't depend on the environment
+func testWorkflow() Workflow {
+	w, _ := OpenWorkflowWithEnv(".", Env{"alfred_version": "5.0"}, false)
+	return w
+}
+
+// runTest runs a workflow and returns its output
+func runTest(t *testing.T, w *Workflow, commands []Command, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	w.RunWithOptions(commands, RunOptions{Args: args, Stdout: &out})
+	return out.String()
+}
+
+// runTell runs a workflow and decodes its Script Filter response
+func runTell(t *testing.T, w *Workflow, commands []Command, args ...string) (r testResponse) {
+	t.Helper()
+	out := runTest(t, w, commands, args...)
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("%q: invalid response %q: %v", args, out, err)
+	}
+	return
+}
+
+func titles(r testResponse) (t []string) {
+	for _, item := range r.Items {
+		t = append(t, item.Title)
+	}
+	return
+}
+
+func TestRunWithOptionsTell(t *testing.T) {
+	commands := []Command{testFilter{"list"}, testFilter{"lost"}, testAction{"open"}}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"menu", []string{""}, []string{"list", "lost"}},
+		{"fuzzy menu", []string{"lis"}, []string{"list"}},
+		{"keyword in arg", []string{"list foo"}, []string{"list"}},
+		{"keyword in data", []string{"foo", `{"keyword":"list","data":"d"}`}, []string{"list:foo:d"}},
+		{"data only", []string{`{"keyword":"lost"}`}, []string{"lost::"}},
+		{"no match", []string{"zzz"}, []string{"No results"}},
+		{"dash query", []string{"-x"}, []string{"No results"}},
+		{"help query", []string{"--help"}, []string{"No results"}},
+		{"too many args", []string{"a", "b", "c"}, []string{"Error: More than 2 args were provided; only 2 are accepted"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := testWorkflow()
+			r := runTell(t, &w, commands, test.args...)
+			if got := titles(r); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunWithOptionsDo(t *testing.T) {
+	commands := []Command{testFilter{"list"}, testAction{"open"}}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"action", []string{`{"keyword":"open","mode":"do","data":"x"}`}, "open did x\n"},
+		{"filter", []string{`{"keyword":"list","mode":"do"}`}, "Error: No valid command in ''\n"},
+		{"final tell", []string{"-final", `{"keyword":"list"}`}, `-trigger {"alfredworkflow":{"arg":"","variables":{"data":"{\"keyword\":\"list\",\"mode\":\"tell\"}"}}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := testWorkflow()
+			if got := runTest(t, &w, commands, test.args...); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunWithOptionsEnv(t *testing.T) {
+	w := testWorkflow()
+	env := Env{"alfred_version": "5.0", "alfred_workflow_name": "test"}
+
+	var name string
+	filter := filterFunc(func(arg, data string) ([]Item, error) {
+		name = w.Name()
+		return nil, nil
+	})
+
+	var out bytes.Buffer
+	w.RunWithOptions([]Command{filter}, RunOptions{
+		Args:   []string{"", `{"keyword":"func"}`},
+		Env:    env,
+		Stdout: &out,
+	})
+
+	if name != "test" {
+		t.Errorf("name during run was %q, want %q", name, "test")
+	}
+	if w.Name() != "" {
+		t.Errorf("name after run was %q, want it restored", w.Name())
+	}
+	if !strings.Contains(out.String(), "No results") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+// filterFunc is a Filter with the keyword "func"
+type filterFunc func(arg, data string) ([]Item, error)
+
+func (f filterFunc) About() CommandDef {
+	return CommandDef{Keyword: "func", IsEnabled: true}
+}
+
+func (f filterFunc) Items(arg, data string) ([]Item, error) {
+	return f(arg, data)
+}
+
+type blockingFilter struct {
+	timeout time.Duration
+}
+
+func (f blockingFilter) About() CommandDef {
+	return CommandDef{Keyword: "block", IsEnabled: true, Timeout: f.timeout}
+}
+
+func (f blockingFilter) ItemsContext(ctx context.Context, arg, data string) ([]Item, error) {
+	<-ctx.Done()
+	return nil, nil
+}
+
+func TestCommandTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		parent  time.Duration
+		want    string
+	}{
+		{"own timeout", 10 * time.Millisecond, 0, "'block' took longer than 10ms"},
+		{"parent deadline", 0, 10 * time.Millisecond, "'block' ran out of time"},
+		{"parent deadline first", time.Minute, 10 * time.Millisecond, "'block' ran out of time"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.parent > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.parent)
+				defer cancel()
+			}
+
+			w := testWorkflow()
+			f := blockingFilter{test.timeout}
+			_, err := w.invokeFilter(ctx, &Invocation{Command: f, Def: f.About()})
+
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("got %v, want an *Error", err)
+			}
+			if e.Hint != test.want {
+				t.Errorf("got %q, want %q", e.Hint, test.want)
+			}
+		})
+	}
+}
+
+type searchableFilter struct {
+	keyword  string
+	children []Command
+}
+
+func (f searchableFilter) About() CommandDef {
+	return CommandDef{Keyword: f.keyword, IsEnabled: true, Searchable: true, Children: f.children}
+}
+
+func (f searchableFilter) Items(arg, data string) ([]Item, error) {
+	return []Item{{UID: f.keyword + arg, Title: f.keyword + " " + arg}}, nil
+}
+
+func TestGlobalSearch(t *testing.T) {
+	commands := []Command{
+		searchableFilter{keyword: "notes"},
+		searchableFilter{keyword: "project", children: []Command{searchableFilter{keyword: "tasks"}}},
+	}
+
+	w := testWorkflow()
+	w.GlobalSearch = true
+	r := runTell(t, &w, commands, "zz")
+
+	want := []string{"notes", "notes zz", "project", "project zz", "project tasks", "tasks zz"}
+	if got := titles(r); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	var data workflowData
+	json.Unmarshal([]byte(r.Items[5].Arg), &data)
+	if data.Keyword != "project tasks" {
+		t.Errorf("got keyword %q, want %q", data.Keyword, "project tasks")
+	}
+}
+
+type treeCommand struct {
+	keyword  string
+	aliases  []string
+	disabled bool
+	children []Command
+}
+
+func (c treeCommand) About() CommandDef {
+	return CommandDef{
+		Keyword:   c.keyword,
+		Aliases:   c.aliases,
+		IsEnabled: !c.disabled,
+		Children:  c.children,
+	}
+}
+
+func (c treeCommand) Items(arg, data string) ([]Item, error) {
+	return nil, nil
+}
+
+var testTree = []Command{
+	treeCommand{keyword: "project", aliases: []string{"p"}, children: []Command{
+		treeCommand{keyword: "list", aliases: []string{"ls"}},
+		treeCommand{keyword: "task", children: []Command{
+			treeCommand{keyword: "add"},
+		}},
+		treeCommand{keyword: "old", disabled: true},
+	}},
+	treeCommand{keyword: "timer"},
+	testAction{"open"},
+}
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		path  string
+		want  func(Command) bool
+		found string
+	}{
+		{"project", nil, "project"},
+		{"project list", nil, "list"},
+		{"p ls", nil, "list"},
+		{"project task add", nil, "add"},
+		{"  project   task  add ", nil, "add"},
+		{"project old", nil, ""},
+		{"project missing", nil, ""},
+		{"list", nil, ""},
+		{"timer", isFilter, "timer"},
+		{"timer", isAction, ""},
+		{"open", isAction, "open"},
+		{"", nil, ""},
+	}
+
+	for _, test := range tests {
+		_, def, found := findCommand(testTree, test.path, test.want)
+		if found != (test.found != "") || def.Keyword != test.found {
+			t.Errorf("%q: got (%q, %v), want %q", test.path, def.Keyword, found, test.found)
+		}
+	}
+}
+
+func TestSplitKeywordPath(t *testing.T) {
+	tests := []struct {
+		arg      string
+		path     string
+		children int
+		rest     string
+	}{
+		{"", "", 3, ""},
+		{"proj", "", 3, "proj"},
+		{"project", "", 3, "project"},
+		{"project ", "project", 3, ""},
+		{"p l", "project", 3, "l"},
+		{"project task add foo", "project task", 1, "add foo"},
+		{"project list foo", "project", 3, "list foo"},
+		{"timer foo", "", 3, "timer foo"},
+		{"  project task ", "project task", 1, ""},
+	}
+
+	for _, test := range tests {
+		path, children, rest := splitKeywordPath(testTree, test.arg)
+		if path != test.path || len(children) != test.children || rest != test.rest {
+			t.Errorf("%q: got (%q, %d, %q), want (%q, %d, %q)", test.arg,
+				path, len(children), rest, test.path, test.children, test.rest)
+		}
+	}
+}
+
+func TestMiddlewareTimeout(t *testing.T) {
+	w := testWorkflow()
+
+	hasDeadline := make(chan bool, 1)
+	w.Use(Middleware{
+		Filter: func(next FilterHandler) FilterHandler {
+			return func(ctx context.Context, inv *Invocation) ([]Item, error) {
+				_, ok := ctx.Deadline()
+				hasDeadline <- ok
+				time.Sleep(time.Second)
+				return next(ctx, inv)
+			}
+		},
+	})
+
+	f := blockingFilter{10 * time.Millisecond}
+	start := time.Now()
+	_, err := w.invokeFilter(context.Background(), &Invocation{Command: f, Def: f.About()})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("middleware wasn't abandoned; took %v", elapsed)
+	}
+	if !<-hasDeadline {
+		t.Error("middleware context had no deadline")
+	}
+}
+
+func TestEvalCommandsOrder(t *testing.T) {
+	w := testWorkflow()
+	w.MenuWorkers = 4
+
+	var commands []Command
+	var want []interface{}
+	for i := 0; i < 20; i++ {
+		keyword := fmt.Sprint(i)
+		commands = append(commands, testFilter{keyword})
+		want = append(want, keyword)
+	}
+
+	results := w.evalCommands(context.Background(), commands, func(ctx context.Context, c Command) interface{} {
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		return c.About().Keyword
+	})
+
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got %v, want %v", results, want)
+	}
+}
+
+func TestEvalCommandsWorkers(t *testing.T) {
+	w := testWorkflow()
+	w.MenuWorkers = 3
+
+	var commands []Command
+	for i := 0; i < 12; i++ {
+		commands = append(commands, testFilter{fmt.Sprint(i)})
+	}
+
+	var active, most int32
+	w.evalCommands(context.Background(), commands, func(ctx context.Context, c Command) interface{} {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		return nil
+	})
+
+	if most > 3 {
+		t.Errorf("%d commands ran at once, want at most 3", most)
+	}
+}
+
+func TestEvalCommandsTimeout(t *testing.T) {
+	w := testWorkflow()
+	w.MenuWorkers = 4
+	w.MenuTimeout = 50 * time.Millisecond
+
+	commands := []Command{testFilter{"fast"}, testFilter{"slow"}, testFilter{"fast2"}}
+
+	start := time.Now()
+	results := w.evalCommands(context.Background(), commands, func(ctx context.Context, c Command) interface{} {
+		keyword := c.About().Keyword
+		if keyword == "slow" {
+			time.Sleep(time.Second)
+		}
+		return keyword
+	})
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %v, want about %v", elapsed, w.MenuTimeout)
+	}
+	if want := []interface{}{"fast", nil, "fast2"}; !reflect.DeepEqual(results, want) {
+		t.Errorf("got %v, want %v", results, want)
+	}
+}
+
+type panickingCommand struct{}
+
+func (c panickingCommand) About() CommandDef {
+	panic("boom")
+}
+
+func (c panickingCommand) Items(arg, data string) ([]Item, error) {
+	return nil, nil
+}
+
+func TestEvalCommandsPanic(t *testing.T) {
+	w := testWorkflow()
+	commands := []Command{testFilter{"ok"}, panickingCommand{}}
+
+	func() {
+		defer func() {
+			if p, ok := recover().(*panicError); !ok || p.value != "boom" {
+				t.Errorf("got panic %v, want boom", p)
+			}
+		}()
+		w.evalCommands(context.Background(), commands, func(ctx context.Context, c Command) interface{} {
+			return c.About()
+		})
+		t.Error("evalCommands didn't panic")
+	}()
+
+	// Run recovers from the panic and reports it
+	w.cacheDir = t.TempDir()
+	r := runTell(t, &w, commands, "")
+	if got := titles(r); len(got) != 1 || got[0] != "Error: panic: boom" {
+		t.Errorf("got %q, want the crash item", got)
+	}
+}